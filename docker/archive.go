@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultHost is the address of the Docker daemon.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// Archiver copies files into and out of containers as tar
+// archives, which works before the container is started and
+// never exposes the data in the container config.
+type Archiver interface {
+	// CopyToContainer extracts the tar archive into the
+	// directory of the container.
+	CopyToContainer(id, dir string, content io.Reader) error
+
+	// CopyFromContainer returns a tar archive of the file
+	// in the container.
+	CopyFromContainer(id, file string) (io.ReadCloser, error)
+}
+
+// archiveClient implements the archive endpoints of the Docker
+// remote API, which are not implemented by dockerclient.
+type archiveClient struct {
+	client *http.Client
+	base   string
+}
+
+// newArchiveClient returns an archive client for the Docker
+// daemon listening at the unix or tcp address.
+func newArchiveClient(host string) (*archiveClient, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "unix":
+		sock := u.Path
+		dialer := &net.Dialer{}
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", sock)
+			},
+		}
+		return &archiveClient{client: &http.Client{Transport: transport}, base: "http://docker"}, nil
+	case "tcp", "http":
+		return &archiveClient{client: &http.Client{}, base: "http://" + u.Host}, nil
+	}
+	return nil, fmt.Errorf("unsupported docker host %s", host)
+}
+
+func (c *archiveClient) CopyToContainer(id, dir string, content io.Reader) error {
+	req, err := http.NewRequest("PUT", c.url(id, dir), content)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("copying files to %s: %s", dir, status(resp))
+	}
+	return nil
+}
+
+func (c *archiveClient) CopyFromContainer(id, file string) (io.ReadCloser, error) {
+	resp, err := c.client.Get(c.url(id, file))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("copying %s: %s", file, status(resp))
+	}
+	return resp.Body, nil
+}
+
+func (c *archiveClient) url(id, path string) string {
+	return fmt.Sprintf("%s/containers/%s/archive?path=%s", c.base, url.QueryEscape(id), url.QueryEscape(path))
+}
+
+// status returns the status of the response, followed by
+// the error message of the daemon.
+func status(resp *http.Response) string {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	msg := strings.TrimSpace(string(body))
+	if len(msg) == 0 {
+		return resp.Status
+	}
+	return resp.Status + ": " + msg
+}
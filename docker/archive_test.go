@@ -0,0 +1,63 @@
+package docker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestArchive(t *testing.T) {
+
+	var uploaded string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/containers/c1/archive":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such container"}`))
+		case r.Method == "PUT" && r.Header.Get("Content-Type") == "application/x-tar":
+			body, _ := ioutil.ReadAll(r.Body)
+			uploaded = r.URL.Query().Get("path") + ":" + string(body)
+		case r.Method == "GET":
+			w.Write([]byte(r.URL.Query().Get("path")))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	g := goblin.Goblin(t)
+	g.Describe("Archive client", func() {
+
+		client, _ := newArchiveClient("tcp://" + strings.TrimPrefix(server.URL, "http://"))
+
+		g.It("Should copy archives into containers", func() {
+			err := client.CopyToContainer("c1", "/run/secrets", strings.NewReader("tar"))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(uploaded).Equal("/run/secrets:tar")
+		})
+
+		g.It("Should copy archives from containers", func() {
+			rc, err := client.CopyFromContainer("c1", "/etc/passwd")
+			g.Assert(err == nil).IsTrue()
+			data, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			g.Assert(string(data)).Equal("/etc/passwd")
+		})
+
+		g.It("Should report errors of the daemon", func() {
+			err := client.CopyToContainer("c2", "/run/secrets", strings.NewReader("tar"))
+			g.Assert(err.Error()).Equal(`copying files to /run/secrets: 404 Not Found: {"message":"No such container"}`)
+			_, err = client.CopyFromContainer("c2", "/etc/passwd")
+			g.Assert(err.Error()).Equal(`copying /etc/passwd: 404 Not Found: {"message":"No such container"}`)
+		})
+
+		g.It("Should reject unsupported hosts", func() {
+			_, err := newArchiveClient("npipe:////./pipe/docker_engine")
+			g.Assert(err.Error()).Equal("unsupported docker host npipe:////./pipe/docker_engine")
+		})
+	})
+}
@@ -1,17 +1,36 @@
 package docker
 
-import "github.com/samalba/dockerclient"
+import (
+	"io"
+	"strings"
+
+	"github.com/samalba/dockerclient"
+)
+
+// helperImage is the image of the ambassador container, and
+// of the containers holding the files mounted into steps.
+const helperImage = "gliderlabs/alpine:3.1"
 
 // Client is a wrapper around the default Docker client
 // that tracks all created containers ensures some default
 // configurations are in place.
 type Client struct {
 	dockerclient.Client
-	info  *dockerclient.ContainerInfo
-	names []string // names of created containers
+	archive *archiveClient
+	info    *dockerclient.ContainerInfo
+	names   []string // names of created containers
 }
 
-func NewClient(docker dockerclient.Client) (*Client, error) {
+// NewClient creates the ambassador container, with a volume
+// at /drone and at each additional path outside of /drone,
+// shared with the containers it creates. The docker client
+// must be connected to the daemon at DefaultHost.
+func NewClient(docker dockerclient.Client, volumes ...string) (*Client, error) {
+	archive, err := newArchiveClient(DefaultHost)
+	if err != nil {
+		return nil, err
+	}
+
 	// creates an ambassador container
 	conf := &dockerclient.ContainerConfig{}
 	conf.HostConfig = dockerclient.HostConfig{
@@ -19,15 +38,32 @@ func NewClient(docker dockerclient.Client) (*Client, error) {
 	}
 	conf.Entrypoint = []string{"/bin/sleep"}
 	conf.Cmd = []string{"86400"}
-	conf.Image = "gliderlabs/alpine:3.1"
+	conf.Image = helperImage
 	conf.Volumes = map[string]struct{}{}
 	conf.Volumes["/drone"] = struct{}{}
+	for _, volume := range volumes {
+		if volume != "/drone" && !strings.HasPrefix(volume, "/drone/") {
+			conf.Volumes[volume] = struct{}{}
+		}
+	}
 	info, err := Start(docker, conf, nil, false)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{Client: docker, info: info}, nil
+	return &Client{Client: docker, archive: archive, info: info}, nil
+}
+
+// CopyToContainer extracts the tar archive into the directory
+// of the container.
+func (c *Client) CopyToContainer(id, dir string, content io.Reader) error {
+	return c.archive.CopyToContainer(id, dir, content)
+}
+
+// CopyFromContainer returns a tar archive of the file in the
+// container.
+func (c *Client) CopyFromContainer(id, file string) (io.ReadCloser, error) {
+	return c.archive.CopyFromContainer(id, file)
 }
 
 // CreateContainer creates a container and internally
@@ -0,0 +1,247 @@
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samalba/dockerclient"
+)
+
+// FileDir is the directory of the volume holding the files
+// mounted into a container. Files outside of the directory are
+// kept in its .files subdirectory, and linked to their path in
+// the container, so the directories of the image are never
+// replaced by the volume.
+const FileDir = "/run/secrets"
+
+// ErrArchive is returned when files are mounted into a container
+// using a client that cannot copy files into containers.
+var ErrArchive = errors.New("copying files into containers is not supported by the client")
+
+// File is a file mounted into a container, such as a secret.
+type File struct {
+	Path string
+	Mode int64
+	Data []byte
+}
+
+// createHolder creates the container holding the files, with
+// a volume at FileDir, and returns its id. The container is
+// never started, and its volume is shared with the container
+// using the files.
+func createHolder(client dockerclient.Client, files []File) (string, error) {
+	if _, ok := client.(Archiver); !ok {
+		return "", ErrArchive
+	}
+	for _, file := range files {
+		if !path.IsAbs(file.Path) || path.Clean(file.Path) == "/" || path.Clean(file.Path) == FileDir {
+			return "", fmt.Errorf("invalid file path %s", file.Path)
+		}
+	}
+	return create(client, &dockerclient.ContainerConfig{
+		Image:      helperImage,
+		Entrypoint: []string{"/bin/true"},
+		Volumes:    map[string]struct{}{FileDir: {}},
+	}, nil, false)
+}
+
+// writeFiles copies the files to the volume of the holder, owned
+// by the user of the container using them, and links the files
+// outside of FileDir to their path in the container.
+//
+// The files are copied as tar archives, so the data is never
+// part of the config of a container or of its environment.
+func writeFiles(client dockerclient.Client, holder, id, user string, files []File) error {
+	archiver, ok := client.(Archiver)
+	if !ok {
+		return ErrArchive
+	}
+	uid, gid, err := fileOwner(archiver, id, user)
+	if err != nil {
+		return err
+	}
+	data, links, err := fileArchives(uid, gid, files)
+	if err != nil {
+		return err
+	}
+	err = archiver.CopyToContainer(holder, FileDir, data)
+	if err != nil {
+		return err
+	}
+	if links == nil {
+		return nil
+	}
+	return archiver.CopyToContainer(id, "/", links)
+}
+
+// removeHolder removes the container holding the files, and
+// the volume with the files.
+func removeHolder(client dockerclient.Client, holder string) {
+	if len(holder) != 0 {
+		client.RemoveContainer(holder, true, true)
+	}
+}
+
+// fileArchives returns the tar archive of the files, relative
+// to FileDir, and the tar archive of the links to the files
+// outside of FileDir, relative to the root directory. The links
+// archive is nil if there are no links.
+func fileArchives(uid, gid int, files []File) (io.Reader, io.Reader, error) {
+	data := &bytes.Buffer{}
+	links := &bytes.Buffer{}
+	dw := tar.NewWriter(data)
+	lw := tar.NewWriter(links)
+	now := time.Now()
+	dirs := map[string]bool{".": true}
+	var linked bool
+	for i, file := range files {
+		name := strings.TrimPrefix(path.Clean(file.Path), FileDir+"/")
+		if path.IsAbs(name) {
+			link := &tar.Header{
+				Name:     strings.TrimPrefix(path.Clean(file.Path), "/"),
+				Typeflag: tar.TypeSymlink,
+				Linkname: path.Join(FileDir, ".files", strconv.Itoa(i)),
+				Mode:     0777,
+				ModTime:  now,
+			}
+			err := lw.WriteHeader(link)
+			if err != nil {
+				return nil, nil, err
+			}
+			linked = true
+			name = path.Join(".files", strconv.Itoa(i))
+		}
+
+		// the parent directories are owned by root, and
+		// readable by the user of the container.
+		var parents []string
+		for dir := path.Dir(name); !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+			parents = append([]string{dir}, parents...)
+		}
+		for _, dir := range parents {
+			err := dw.WriteHeader(&tar.Header{
+				Name:     dir + "/",
+				Typeflag: tar.TypeDir,
+				Mode:     0755,
+				ModTime:  now,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		err := dw.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     file.Mode,
+			Uid:      uid,
+			Gid:      gid,
+			Size:     int64(len(file.Data)),
+			ModTime:  now,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = dw.Write(file.Data)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	err := dw.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = lw.Close()
+	if err != nil || !linked {
+		return data, nil, err
+	}
+	return data, links, nil
+}
+
+// fileOwner returns the numeric user and group owning the files
+// for the user of the container, such as node or 1000:1000. User
+// and group names are looked up in the /etc/passwd and /etc/group
+// files of the container. The files of containers running as
+// root are owned by root.
+func fileOwner(archiver Archiver, id, user string) (int, int, error) {
+	if len(user) == 0 || user == "root" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(user, ":", 2)
+	uid, err := strconv.Atoi(parts[0])
+	gid := 0
+	if err != nil {
+		passwd, err := readFile(archiver, id, "/etc/passwd")
+		if err != nil {
+			return 0, 0, fmt.Errorf("looking up user %s: %s", parts[0], err)
+		}
+		entry, ok := lookupEntry(passwd, parts[0])
+		if !ok || len(entry) < 4 {
+			return 0, 0, fmt.Errorf("unknown user %s", parts[0])
+		}
+		uid, err = strconv.Atoi(entry[2])
+		if err == nil {
+			gid, err = strconv.Atoi(entry[3])
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid passwd entry for user %s", parts[0])
+		}
+	}
+	if len(parts) == 1 {
+		return uid, gid, nil
+	}
+
+	gid, err = strconv.Atoi(parts[1])
+	if err != nil {
+		group, err := readFile(archiver, id, "/etc/group")
+		if err != nil {
+			return 0, 0, fmt.Errorf("looking up group %s: %s", parts[1], err)
+		}
+		entry, ok := lookupEntry(group, parts[1])
+		if !ok || len(entry) < 3 {
+			return 0, 0, fmt.Errorf("unknown group %s", parts[1])
+		}
+		gid, err = strconv.Atoi(entry[2])
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid group entry for group %s", parts[1])
+		}
+	}
+	return uid, gid, nil
+}
+
+// readFile reads the file from the container.
+func readFile(archiver Archiver, id, file string) ([]byte, error) {
+	rc, err := archiver.CopyFromContainer(id, file)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	_, err = tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(tr)
+}
+
+// lookupEntry returns the fields of the entry of the passwd or
+// group file with the name.
+func lookupEntry(data []byte, name string) ([]string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if fields[0] == name {
+			return fields, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,202 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/samalba/dockerclient"
+)
+
+func TestFiles(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Container files", func() {
+
+		files := []File{{Path: "/run/secrets/TOKEN", Mode: 0400, Data: []byte("hunter2")}}
+
+		g.It("Should copy the files to a holder shared with the container", func() {
+			client := newFakeClient("1000:1000")
+			conf := &dockerclient.ContainerConfig{Image: "golang", Cmd: []string{"go", "test"}}
+			_, err := RunFiles(client, conf, nil, false, files, ioutil.Discard, ioutil.Discard)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(client.configs)).Equal(2)
+
+			holder, step := client.configs[0], client.configs[1]
+			g.Assert(holder.Volumes).Equal(map[string]struct{}{"/run/secrets": {}})
+			g.Assert(step.HostConfig.VolumesFrom).Equal([]string{"c0"})
+
+			g.Assert(len(client.copied)).Equal(1)
+			copied := client.copied[0]
+			g.Assert(copied.id + ":" + copied.dir).Equal("c0:/run/secrets")
+			g.Assert(len(copied.headers)).Equal(1)
+			g.Assert(copied.headers[0].Name).Equal("TOKEN")
+			g.Assert(copied.headers[0].Mode).Equal(int64(0400))
+			g.Assert(copied.headers[0].Uid).Equal(1000)
+			g.Assert(copied.headers[0].Gid).Equal(1000)
+			g.Assert(copied.data[0]).Equal("hunter2")
+
+			// the container and holder are removed once the
+			// step finishes.
+			g.Assert(client.removed).Equal([]string{"c1", "c0"})
+			g.Assert(client.started).Equal([]string{"c1"})
+		})
+
+		g.It("Should never pass the data in a container config", func() {
+			client := newFakeClient("1000")
+			files := []File{
+				{Path: "/run/secrets/TOKEN", Mode: 0400, Data: []byte("hunter2")},
+				{Path: "/root/.ssh/id_rsa", Mode: 0400, Data: []byte("correct horse")},
+			}
+			_, err := RunFiles(client, &dockerclient.ContainerConfig{Image: "golang"}, nil, false, files, ioutil.Discard, ioutil.Discard)
+			g.Assert(err == nil).IsTrue()
+			for _, conf := range client.configs {
+				g.Assert(strings.Contains(fmt.Sprint(*conf), "hunter2")).IsFalse()
+				g.Assert(strings.Contains(fmt.Sprint(*conf), "correct horse")).IsFalse()
+			}
+		})
+
+		g.It("Should link the files outside of the volume", func() {
+			client := newFakeClient("")
+			files := []File{{Path: "/root/.ssh/id_rsa", Mode: 0400, Data: []byte("key")}}
+			_, err := StartFiles(client, &dockerclient.ContainerConfig{Image: "golang"}, nil, false, files)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(client.configs[0].Volumes).Equal(map[string]struct{}{"/run/secrets": {}})
+			g.Assert(len(client.copied)).Equal(2)
+
+			data, links := client.copied[0], client.copied[1]
+			g.Assert(data.headers[0].Name).Equal(".files/")
+			g.Assert(data.headers[1].Name).Equal(".files/0")
+			g.Assert(data.data[1]).Equal("key")
+			g.Assert(links.id + ":" + links.dir).Equal("c1:/")
+			g.Assert(links.headers[0].Name).Equal("root/.ssh/id_rsa")
+			g.Assert(links.headers[0].Linkname).Equal("/run/secrets/.files/0")
+		})
+
+		g.It("Should look up named users in the container", func() {
+			client := newFakeClient("node:staff")
+			client.files["/etc/passwd"] = "root:x:0:0:root:/root:/bin/sh\nnode:x:1000:1000::/home/node:/bin/sh\n"
+			client.files["/etc/group"] = "root:x:0:\nstaff:x:50:node\n"
+			uid, gid, err := fileOwner(client, "c1", "node")
+			g.Assert(err == nil).IsTrue()
+			g.Assert([]int{uid, gid}).Equal([]int{1000, 1000})
+
+			uid, gid, err = fileOwner(client, "c1", "node:staff")
+			g.Assert(err == nil).IsTrue()
+			g.Assert([]int{uid, gid}).Equal([]int{1000, 50})
+
+			_, _, err = fileOwner(client, "c1", "nobody")
+			g.Assert(err.Error()).Equal("unknown user nobody")
+		})
+
+		g.It("Should fail for users missing from the container", func() {
+			client := newFakeClient("node")
+			_, err := RunFiles(client, &dockerclient.ContainerConfig{Image: "node"}, nil, false, files, nil, nil)
+			g.Assert(err.Error()).Equal("looking up user node: no such file /etc/passwd")
+			g.Assert(client.started == nil).IsTrue()
+			g.Assert(client.removed).Equal([]string{"c1", "c0"})
+		})
+
+		g.It("Should reject relative file paths", func() {
+			client := newFakeClient("")
+			_, err := StartFiles(client, &dockerclient.ContainerConfig{Image: "golang"}, nil, false, []File{{Path: "run/secrets/TOKEN"}})
+			g.Assert(err.Error()).Equal("invalid file path run/secrets/TOKEN")
+			g.Assert(len(client.configs)).Equal(0)
+		})
+	})
+}
+
+// fakeClient records the containers created, started and
+// removed, and the archives copied into them, and reports the
+// user of the images.
+type fakeClient struct {
+	dockerclient.Client
+	user    string
+	files   map[string]string
+	configs []*dockerclient.ContainerConfig
+	copied  []*fakeArchive
+	started []string
+	removed []string
+}
+
+// fakeArchive is a tar archive copied into a container.
+type fakeArchive struct {
+	id, dir string
+	headers []*tar.Header
+	data    []string
+}
+
+func newFakeClient(user string) *fakeClient {
+	return &fakeClient{user: user, files: map[string]string{}}
+}
+
+func (c *fakeClient) CopyToContainer(id, dir string, content io.Reader) error {
+	archive := &fakeArchive{id: id, dir: dir}
+	tr := tar.NewReader(content)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		data, _ := ioutil.ReadAll(tr)
+		archive.headers = append(archive.headers, hdr)
+		archive.data = append(archive.data, string(data))
+	}
+	c.copied = append(c.copied, archive)
+	return nil
+}
+
+func (c *fakeClient) CopyFromContainer(id, file string) (io.ReadCloser, error) {
+	data, ok := c.files[file]
+	if !ok {
+		return nil, fmt.Errorf("no such file %s", file)
+	}
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Name: path.Base(file), Mode: 0644, Size: int64(len(data))})
+	tw.Write([]byte(data))
+	tw.Close()
+	return ioutil.NopCloser(buf), nil
+}
+
+func (c *fakeClient) CreateContainer(conf *dockerclient.ContainerConfig, name string, auth *dockerclient.AuthConfig) (string, error) {
+	c.configs = append(c.configs, conf)
+	return fmt.Sprintf("c%d", len(c.configs)-1), nil
+}
+
+func (c *fakeClient) InspectContainer(id string) (*dockerclient.ContainerInfo, error) {
+	return &dockerclient.ContainerInfo{
+		Id:     id,
+		Config: &dockerclient.ContainerConfig{User: c.user},
+		State:  &dockerclient.State{},
+	}, nil
+}
+
+func (c *fakeClient) StartContainer(id string, conf *dockerclient.HostConfig) error {
+	c.started = append(c.started, id)
+	return nil
+}
+
+func (c *fakeClient) ContainerLogs(id string, opts *dockerclient.LogOptions) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (c *fakeClient) StopContainer(id string, timeout int) error { return nil }
+
+func (c *fakeClient) KillContainer(id, signal string) error { return nil }
+
+func (c *fakeClient) RemoveContainer(id string, force, volumes bool) error {
+	c.removed = append(c.removed, id)
+	return nil
+}
+
+func (c *fakeClient) PullImage(name string, auth *dockerclient.AuthConfig) error { return nil }
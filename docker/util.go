@@ -4,7 +4,6 @@ import (
 	"errors"
 	"io"
 	"os"
-	// "strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/samalba/dockerclient"
@@ -32,6 +31,12 @@ var (
 )
 
 func Run(client dockerclient.Client, conf *dockerclient.ContainerConfig, auth *dockerclient.AuthConfig, pull bool, outw, errw io.Writer) (*dockerclient.ContainerInfo, error) {
+	return RunFiles(client, conf, auth, pull, nil, outw, errw)
+}
+
+// RunFiles runs the container with the files mounted into it.
+// The container is removed once it exits, along with the files.
+func RunFiles(client dockerclient.Client, conf *dockerclient.ContainerConfig, auth *dockerclient.AuthConfig, pull bool, files []File, outw, errw io.Writer) (*dockerclient.ContainerInfo, error) {
 	if outw == nil {
 		outw = os.Stdout
 	}
@@ -40,7 +45,7 @@ func Run(client dockerclient.Client, conf *dockerclient.ContainerConfig, auth *d
 	}
 
 	// fetches the container information.
-	info, err := Start(client, conf, auth, pull)
+	info, holder, err := startFiles(client, conf, auth, pull, files)
 	if err != nil {
 		return nil, err
 	}
@@ -50,6 +55,10 @@ func Run(client dockerclient.Client, conf *dockerclient.ContainerConfig, auth *d
 	defer func() {
 		client.StopContainer(info.Id, 5)
 		client.KillContainer(info.Id, "9")
+		if len(holder) != 0 {
+			client.RemoveContainer(info.Id, true, true)
+			client.RemoveContainer(holder, true, true)
+		}
 	}()
 
 	// channel listening for errors while the
@@ -89,6 +98,76 @@ func Run(client dockerclient.Client, conf *dockerclient.ContainerConfig, auth *d
 }
 
 func Start(client dockerclient.Client, conf *dockerclient.ContainerConfig, auth *dockerclient.AuthConfig, pull bool) (*dockerclient.ContainerInfo, error) {
+	return StartFiles(client, conf, auth, pull, nil)
+}
+
+// StartFiles starts the container with the files mounted into
+// it. The files are removed with the container.
+func StartFiles(client dockerclient.Client, conf *dockerclient.ContainerConfig, auth *dockerclient.AuthConfig, pull bool, files []File) (*dockerclient.ContainerInfo, error) {
+	info, _, err := startFiles(client, conf, auth, pull, files)
+	return info, err
+}
+
+// startFiles starts the container with the files mounted into
+// it, and returns the id of the container holding the files.
+func startFiles(client dockerclient.Client, conf *dockerclient.ContainerConfig, auth *dockerclient.AuthConfig, pull bool, files []File) (*dockerclient.ContainerInfo, string, error) {
+
+	// creates the volumes holding the files, shared with
+	// the container.
+	var holder string
+	if len(files) != 0 {
+		var err error
+		holder, err = createHolder(client, files)
+		if err != nil {
+			log.Errorf("Error creating files for %s. %s\n", conf.Image, err)
+			return nil, "", err
+		}
+		conf.HostConfig.VolumesFrom = append(conf.HostConfig.VolumesFrom, holder)
+	}
+
+	id, err := create(client, conf, auth, pull)
+	if err != nil {
+		removeHolder(client, holder)
+		return nil, "", err
+	}
+
+	// fetches the container information
+	info, err := client.InspectContainer(id)
+	if err != nil {
+		log.Errorf("Error inspecting %s. %s\n", conf.Image, err)
+		client.RemoveContainer(id, true, true)
+		removeHolder(client, holder)
+		return nil, "", err
+	}
+
+	// writes the files once the container is created, so
+	// they are owned by the user of its image, and are never
+	// part of the container config.
+	if len(files) != 0 {
+		var user string
+		if info.Config != nil {
+			user = info.Config.User
+		}
+		err = writeFiles(client, holder, id, user, files)
+		if err != nil {
+			log.Errorf("Error writing files for %s. %s\n", conf.Image, err)
+			client.RemoveContainer(id, true, true)
+			removeHolder(client, holder)
+			return nil, "", err
+		}
+	}
+
+	// starts the container
+	err = client.StartContainer(id, &conf.HostConfig)
+	if err != nil {
+		log.Errorf("Error starting %s. %s\n", conf.Image, err)
+	}
+	return info, holder, err
+}
+
+// create creates the container, pulling the image first if
+// pull is true, or if the container cannot be created.
+func create(client dockerclient.Client, conf *dockerclient.ContainerConfig, auth *dockerclient.AuthConfig, pull bool) (string, error) {
 
 	// force-pull the image if specified.
 	if pull {
@@ -105,28 +184,14 @@ func Start(client dockerclient.Client, conf *dockerclient.ContainerConfig, auth
 		err = client.PullImage(conf.Image, auth)
 		if err != nil {
 			log.Errorf("Error pulling %s. %s\n", conf.Image, err)
-			return nil, err
+			return "", err
 		}
 		id, err = client.CreateContainer(conf, "", auth)
 		if err != nil {
 			log.Errorf("Error creating %s. %s\n", conf.Image, err)
 			client.RemoveContainer(id, true, true)
-			return nil, err
+			return "", err
 		}
 	}
-
-	// fetches the container information
-	info, err := client.InspectContainer(id)
-	if err != nil {
-		log.Errorf("Error inspecting %s. %s\n", conf.Image, err)
-		client.RemoveContainer(id, true, true)
-		return nil, err
-	}
-
-	// starts the container
-	err = client.StartContainer(id, &conf.HostConfig)
-	if err != nil {
-		log.Errorf("Error starting %s. %s\n", conf.Image, err)
-	}
-	return info, err
+	return id, nil
 }
@@ -3,6 +3,7 @@ package exec
 import (
 	"fmt"
 	"io"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/drone/drone-exec/yaml/path"
 	"github.com/drone/drone-exec/yaml/secure"
 	"github.com/drone/drone-exec/yaml/shasum"
+	"github.com/drone/drone-exec/yaml/signature"
 	"github.com/drone/drone-plugin-go/plugin"
 	"github.com/samalba/dockerclient"
 
@@ -26,6 +28,7 @@ type Payload struct {
 	Yaml      string            `json:"config"`
 	YamlEnc   string            `json:"secret"`
 	Repo      *plugin.Repo      `json:"repo"`
+	HeadRepo  *plugin.Repo      `json:"head_repo"`
 	Build     *plugin.Build     `json:"build"`
 	BuildLast *plugin.Build     `json:"build_last"`
 	Job       *plugin.Job       `json:"job"`
@@ -33,6 +36,18 @@ type Payload struct {
 	Keys      *plugin.Keypair   `json:"keys"`
 	System    *plugin.System    `json:"system"`
 	Workspace *plugin.Workspace `json:"workspace"`
+
+	// Base is the base Yaml configuration provided by the
+	// system, defining mandatory steps and locked values.
+	Base string `json:"base_config"`
+
+	// Signature is the base64 encoded detached signature of
+	// the Yaml configuration.
+	Signature string `json:"config_signature"`
+
+	// TrustedKeys are the PEM encoded public keys, provided by
+	// the system, trusted to sign the Yaml configuration.
+	TrustedKeys []string `json:"trusted_keys"`
 }
 
 // Options defines execution options.
@@ -44,7 +59,46 @@ type Options struct {
 	Notify bool   // execute notify steps
 	Debug  bool   // execute in debug mode
 	Force  bool   // force pull plugin images
+	Strict bool   // reject unknown Yaml keys
 	Mount  string // mounts the volume on the host machine
+
+	IncludeDir string // directory of shared Yaml includes
+
+	// WorkspaceRoot is the root directory of the workspace,
+	// and WorkspacePath the template of the workspace path
+	// relative to the root, such as {host}/{owner}/{name}.
+	// If empty the defaults of the path package are used.
+	WorkspaceRoot string
+	WorkspacePath string
+
+	// Unresolved selects how parameters left in the Yaml after
+	// injection are handled: ignored by default, logged as
+	// warnings when set to "warn", or rejected when set to
+	// "error".
+	Unresolved string
+
+	// SafePolicy defines the sections and fields protected from
+	// secret injection for pull requests, and from global
+	// variables for public repositories. If nil the default
+	// policy is used.
+	SafePolicy *inject.Policy
+
+	// RequireSignature rejects configurations that are not
+	// signed by a trusted key, even if the checksum matches.
+	RequireSignature bool
+
+	// SecretPolicy defines how secrets are injected for each
+	// kind of build. If nil the default policy is used.
+	SecretPolicy *SecretPolicy
+
+	// Secrets provides the secrets of the repository. If nil
+	// the encrypted secrets in the payload are used.
+	Secrets secure.SecretProvider
+
+	// Report is the file the JSON report of the build, with
+	// the steps that were skipped, is written to. If empty no
+	// report is written.
+	Report string
 }
 
 // Error reports an error during execution of a build.
@@ -57,108 +111,61 @@ func (e *Error) Error() string { return fmt.Sprintf("build failed (exit code %d)
 // Exec executes a build with the given payload and options. If the
 // build fails, an *Error is returned.
 func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
+	// secrets are provided by the configured provider, or
+	// else decrypted from the payload.
+	provider := opt.Secrets
+	if provider == nil && payload.Keys != nil && len(payload.YamlEnc) != 0 {
+		provider = secure.NewEncryptedProvider(payload.YamlEnc, payload.Keys.Private)
+	}
+
 	var sec *secure.Secure
-	if payload.Keys != nil && len(payload.YamlEnc) != 0 {
+	var secrets map[string]*secure.Secret
+	if provider != nil {
 		var err error
-		sec, err = secure.Parse(payload.YamlEnc, payload.Keys.Private)
+		sec, err = provider.Secrets(payload.Repo.FullName)
 		if err != nil {
-			return fmt.Errorf("decrypting encrypted secrets: %s", err)
+			return fmt.Errorf("loading secrets: %s", err)
 		}
-		log.Debugln("Successfully decrypted secrets")
+		log.Debugln("Successfully loaded secrets")
 	}
 
+	// the deploy and notify steps are disabled if the policy
+	// does not allow them for the kind of build.
+	policy := opt.SecretPolicy
+	if policy == nil {
+		policy = DefaultSecretPolicy
+	}
+	rule := policy.Rule(&payload)
+	opt.Deploy = opt.Deploy && rule.Deploy
+	opt.Notify = opt.Notify && rule.Notify
+
 	// TODO This block of code (and the above block) need to be cleaned
 	//      up and written in a manner that facilitates better unit testing.
+	safe := rule.Secrets == SecretsSafe
 	if sec != nil {
-		verified := shasum.Check(payload.Yaml, sec.Checksum)
-
-		// the checksum should be invalidated if the repository is
-		// public, and the build is a pull request, and the checksum
-		// value was not provided.
-		if payload.Build.Event == plugin.EventPull && !payload.Repo.IsPrivate && len(sec.Checksum) == 0 {
-			verified = false
-		}
-
+		verified := verify(&payload, sec, opt)
 		switch {
-		case verified && payload.Build.Event == plugin.EventPull:
-			log.Debugln("Injected secrets into Yaml safely")
-			var err error
-			payload.Yaml, err = inject.InjectSafe(payload.Yaml, sec.Environment.Map())
-			if err != nil {
-				return fmt.Errorf("injecting yaml secrets: %s", err)
-			}
-		case verified:
-			log.Debugln("Injected secrets into Yaml")
-			payload.Yaml = inject.Inject(payload.Yaml, sec.Environment.Map())
 		case !verified:
 			// if we can't validate the Yaml file we don't inject
 			// secrets, and therefore shouldn't bother running the
 			// deploy and notify tests.
 			opt.Deploy = false
 			opt.Notify = false
-			log.Debugln("Unable to validate Yaml checksum.", sec.Checksum)
-		}
-	}
-
-	// injects the matrix configuration parameters
-	// into the yaml prior to parsing.
-	injectParams := map[string]string{
-		"COMMIT_SHORT": payload.Build.Commit, // DEPRECATED
-		"COMMIT":       payload.Build.Commit,
-		"BRANCH":       payload.Build.Branch,
-		"BUILD_NUMBER": strconv.Itoa(payload.Build.Number),
-	}
-	if payload.Build.Event == plugin.EventTag {
-		injectParams["TAG"] = strings.TrimPrefix(payload.Build.Ref, "refs/tags/")
-	}
-	payload.Yaml = inject.Inject(payload.Yaml, payload.Job.Environment)
-	payload.Yaml = inject.Inject(payload.Yaml, injectParams)
-
-	// safely inject global variables
-	var globals = map[string]string{}
-	for _, s := range payload.System.Globals {
-		parts := strings.SplitN(s, "=", 2)
-		if len(parts) != 2 {
-			continue
+			log.Debugln("Unable to validate Yaml signature or checksum.", sec.Checksum)
+		case !rule.Secrets.injects():
+			log.Debugln("Secrets are disabled for this build by the secret policy")
+		default:
+			log.Debugln("Injected secrets into Yaml")
+			var err error
+			payload.Yaml, err = injectSecrets(&payload, sec, safe, opt)
+			if err != nil {
+				return fmt.Errorf("injecting yaml secrets: %s", err)
+			}
+			secrets = sec.Environment.Secrets()
 		}
-		globals[parts[0]] = parts[1]
 	}
-	if payload.Repo.IsPrivate {
-		payload.Yaml = inject.Inject(payload.Yaml, globals)
-	} else {
-		payload.Yaml, _ = inject.InjectSafe(payload.Yaml, globals)
-	}
-
-	// extracts the clone path from the yaml. If
-	// the clone path doesn't exist it uses a path
-	// derrived from the repository uri.
-	payload.Workspace = &plugin.Workspace{Keys: payload.Keys, Netrc: payload.Netrc}
-	payload.Workspace.Path = path.Parse(payload.Yaml, payload.Repo.Link)
-	payload.Workspace.Root = "/drone/src"
-	log.Debugf("Using workspace %s", payload.Workspace.Path)
 
-	rules := []parser.RuleFunc{
-		parser.ImageName,
-		parser.ImageMatchFunc(payload.System.Plugins),
-		parser.ImagePullFunc(opt.Force),
-		parser.SanitizeFunc(payload.Repo.IsTrusted), //&& !plugin.PullRequest(payload.Build)
-		parser.CacheFunc(payload.Repo.FullName),
-		parser.DebugFunc(yaml.ParseDebugString(payload.Yaml)),
-		parser.Escalate,
-		parser.HttpProxy,
-		parser.DefaultNotifyFilter,
-	}
-	if len(opt.Mount) != 0 {
-		log.Debugf("Mounting %s as workspace %s",
-			opt.Mount,
-			payload.Workspace.Path,
-		)
-		rules = append(rules, parser.MountFunc(
-			opt.Mount,
-			payload.Workspace.Path,
-		))
-	}
-	tree, err := parser.Parse(payload.Yaml, rules)
+	tree, err := load(&payload, opt, knownNames(&payload, sec))
 	if err != nil {
 		// TODO(sqs): There was a comment here saying "print error
 		// messages in debug mode only". Is this because of security
@@ -167,16 +174,17 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 		// a simple error message such as "error parsing yaml".
 		return err
 	}
+	mountSecrets(tree, &payload, secrets, safe, opt)
 	r := runner.Load(tree)
 
-	client, err := dockerclient.NewDockerClient("unix:///var/run/docker.sock", nil)
+	client, err := dockerclient.NewDockerClient(docker.DefaultHost, nil)
 	if err != nil {
 		return err
 	}
 
 	// // creates a wrapper Docker client that uses an ambassador
 	// // container to create a pod-like environment.
-	controller, err := docker.NewClient(client)
+	controller, err := docker.NewClient(client, workspaceRoot(opt))
 	if err != nil {
 		return fmt.Errorf("creating docker ambassador container: %s", err)
 	}
@@ -248,6 +256,13 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 		}
 	}
 
+	if len(opt.Report) != 0 {
+		err = writeReport(opt.Report, state)
+		if err != nil {
+			log.Warnf("writing report: %s", err)
+		}
+	}
+
 	if state.Failed() {
 		controller.Destroy()
 		return &Error{ExitCode: state.ExitCode()}
@@ -255,3 +270,325 @@ func Exec(payload Payload, opt Options, outw, errw io.Writer) error {
 
 	return nil
 }
+
+// verify returns true if the Yaml is signed by a trusted key or,
+// unless a signature is required, matches the checksum of the
+// secrets.
+func verify(payload *Payload, sec *secure.Secure, opt Options) bool {
+	if len(payload.Signature) != 0 {
+		err := signature.Verify(payload.Yaml, payload.Signature, payload.TrustedKeys)
+		if err != nil {
+			log.Warnln(err)
+			return false
+		}
+		return true
+	}
+	if opt.RequireSignature {
+		log.Warnln(signature.ErrUnsigned)
+		return false
+	}
+
+	// the checksum should be invalidated if the repository is
+	// public, and the build is a pull request, and the checksum
+	// value was not provided.
+	if payload.Build.Event == plugin.EventPull && !payload.Repo.IsPrivate && len(sec.Checksum) == 0 {
+		return false
+	}
+	return shasum.Check(payload.Yaml, sec.Checksum)
+}
+
+// injectSecrets injects the secrets allowed for the build event
+// and branch into the Yaml. Secrets restricted to images are only
+// injected into the steps using those images. If safe, the
+// sections and fields protected by the safe policy are not
+// injected.
+func injectSecrets(payload *Payload, sec *secure.Secure, safe bool, opt Options) (string, error) {
+	secrets := sec.Environment.Secrets()
+	params := map[string]string{}
+	scoped := map[string]string{}
+	for name, secret := range secrets {
+		switch {
+		case !secret.MatchBuild(payload.Build.Event, payload.Build.Branch):
+			log.Warnf("Secret %s is not allowed for %s builds of branch %s",
+				name,
+				payload.Build.Event,
+				payload.Build.Branch,
+			)
+		case len(secret.Images) == 0:
+			params[name] = secret.Value
+		default:
+			scoped[name] = secret.Value
+		}
+	}
+
+	// the image of each step is checked once the includes,
+	// templates and locked values are merged, since they may
+	// replace the image.
+	resolved, _, err := resolve(payload.Yaml, payload, opt)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := inject.Inject(payload.Yaml, params)
+	if err != nil {
+		return "", err
+	}
+	raw, err = inject.InjectSteps(raw, resolved, scoped, func(name, image string) bool {
+		return secrets[name].MatchImage(image)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// secrets that are not allowed are left unresolved, and
+	// reported so the Yaml can be fixed.
+	for _, ref := range inject.Unresolved(raw) {
+		if _, ok := secrets[ref.Name]; ok {
+			log.Warnf("yaml: line %d, column %d: secret %s is not allowed in this step",
+				ref.Line,
+				ref.Column,
+				ref.Name,
+			)
+		}
+	}
+
+	if safe {
+		return inject.Protect(payload.Yaml, raw, opt.SafePolicy)
+	}
+	return raw, nil
+}
+
+// mountSecrets resolves the values of the secrets mounted as
+// files into the steps. Secrets that are not available, or not
+// allowed for the step, are not mounted. If safe, the secrets
+// are not mounted into the sections protected by the safe
+// policy.
+func mountSecrets(tree *parser.Tree, payload *Payload, secrets map[string]*secure.Secret, safe bool, opt Options) {
+	policy := opt.SafePolicy
+	if policy == nil {
+		policy = inject.DefaultPolicy
+	}
+
+	for _, step := range tree.Steps() {
+		var files []*parser.SecretFile
+		for _, file := range step.Secrets {
+			secret, ok := secrets[file.Source]
+			switch {
+			case !ok:
+				log.Warnf("Secret %s is not available for %s", file.Source, step)
+			case !secret.MatchBuild(payload.Build.Event, payload.Build.Branch) || !secret.MatchImage(step.Image):
+				log.Warnf("Secret %s is not allowed for %s", file.Source, step)
+			case safe && !step.Mandatory && contains(policy.Sections, step.NodeType.String()):
+				log.Warnf("Secret %s is not mounted into %s for this build", file.Source, step)
+			default:
+				file.Value = secret.Value
+				files = append(files, file)
+			}
+		}
+		step.Secrets = files
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceRoot returns the root directory of the workspace.
+func workspaceRoot(opt Options) string {
+	if len(opt.WorkspaceRoot) == 0 {
+		return path.DefaultRoot
+	}
+	return filepath.Clean(opt.WorkspaceRoot)
+}
+
+// Tree parses the payload and returns the execution tree
+// without running the build. Secrets are not decrypted or
+// injected into the tree, and neither are the global
+// variables, which may hold secrets. Parameters left
+// unresolved are therefore never an error.
+func Tree(payload Payload, opt Options) (*parser.Tree, error) {
+	known := knownNames(&payload, nil)
+	system := *payload.System
+	system.Globals = nil
+	payload.System = &system
+	if opt.Unresolved == "error" {
+		opt.Unresolved = "warn"
+	}
+	return load(&payload, opt, known)
+}
+
+// knownNames returns the names of the secrets and global
+// variables, which are left unresolved on purpose when they
+// are not allowed for the build or the step.
+func knownNames(payload *Payload, sec *secure.Secure) map[string]bool {
+	names := map[string]bool{}
+	for name := range globals(payload.System) {
+		names[name] = true
+	}
+	if sec != nil {
+		for name := range sec.Environment.Secrets() {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// load injects the build parameters into the Yaml and
+// parses the execution tree. It also sets the payload
+// workspace. The known parameters are not reported when
+// left unresolved.
+func load(payload *Payload, opt Options, known map[string]bool) (*parser.Tree, error) {
+	// expands the Yaml includes and templates. This happens
+	// after secrets are injected, since the included files
+	// are not verified by the checksum.
+	var base *yaml.Base
+	var err error
+	payload.Yaml, base, err = resolve(payload.Yaml, payload, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	// injects the matrix configuration parameters
+	// into the yaml prior to parsing.
+	payload.Yaml, err = inject.Inject(payload.Yaml, payload.Job.Environment)
+	if err != nil {
+		return nil, err
+	}
+	payload.Yaml, err = inject.Inject(payload.Yaml, params(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	// safely inject global variables
+	if payload.Repo.IsPrivate {
+		payload.Yaml, err = inject.Inject(payload.Yaml, globals(payload.System))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		payload.Yaml, _ = inject.InjectPolicy(payload.Yaml, globals(payload.System), opt.SafePolicy)
+	}
+
+	// reports the parameters that were not injected, usually
+	// because a secret or matrix variable is missing. Known
+	// secrets are left unresolved on purpose, for example in
+	// the sections protected by the safe policy.
+	for _, ref := range inject.Unresolved(payload.Yaml) {
+		if known[ref.Name] {
+			continue
+		}
+		switch opt.Unresolved {
+		case "error":
+			return nil, fmt.Errorf("yaml: %s", ref)
+		case "warn":
+			log.Warnf("yaml: %s", ref)
+		}
+	}
+	payload.Yaml = inject.Unescape(payload.Yaml)
+
+	// extracts the clone path from the yaml. If
+	// the clone path doesn't exist it uses a path
+	// derrived from the repository uri.
+	payload.Workspace = &plugin.Workspace{Keys: payload.Keys, Netrc: payload.Netrc}
+	root := workspaceRoot(opt)
+	payload.Workspace.Path, err = path.ParseRoot(payload.Yaml, payload.Repo.Link, root, opt.WorkspacePath)
+	if err != nil {
+		return nil, err
+	}
+	payload.Workspace.Root = root
+	log.Debugf("Using workspace %s", payload.Workspace.Path)
+
+	rules := []parser.RuleFunc{
+		parser.ImageName,
+		parser.ImageMatchFunc(payload.System.Plugins),
+		parser.ImagePullFunc(opt.Force),
+		parser.SanitizeFunc(payload.Repo.IsTrusted), //&& !plugin.PullRequest(payload.Build)
+		parser.CacheFunc(payload.Repo.FullName),
+		parser.DebugFunc(yaml.ParseDebugString(payload.Yaml)),
+		parser.Escalate,
+		parser.HttpProxy,
+		parser.DefaultNotifyFilter,
+	}
+	if len(opt.Mount) != 0 {
+		log.Debugf("Mounting %s as workspace %s",
+			opt.Mount,
+			payload.Workspace.Path,
+		)
+		rules = append(rules, parser.MountFunc(
+			opt.Mount,
+			payload.Workspace.Path,
+		))
+	}
+	parse := yaml.ParseString
+	if opt.Strict {
+		parse = yaml.ParseStringStrict
+	}
+	conf, err := parse(payload.Yaml)
+	if err != nil {
+		return nil, err
+	}
+	return parser.LoadBase(conf, base, rules)
+}
+
+// resolve upgrades the Yaml to the current version of the
+// format, expands the includes and templates, and merges the
+// locked values of the base configuration.
+func resolve(raw string, payload *Payload, opt Options) (string, *yaml.Base, error) {
+	// upgrades the Yaml to the current version of the
+	// format, so the includes, templates and locked values
+	// are merged with a current document.
+	raw, err := yaml.MigrateString(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	raw, err = yaml.ResolveString(raw, []string{opt.Mount, opt.IncludeDir})
+	if err != nil {
+		return "", nil, err
+	}
+
+	// merges the locked values of the base configuration,
+	// which take precedence over the repository values.
+	rawBase, err := inject.Inject(payload.Base, params(payload))
+	if err != nil {
+		return "", nil, fmt.Errorf("parsing base yaml: %s", err)
+	}
+	base, err := yaml.ParseBaseString(rawBase)
+	if err != nil {
+		return "", nil, fmt.Errorf("parsing base yaml: %s", err)
+	}
+	raw, err = base.LockString(raw)
+	return raw, base, err
+}
+
+// globals returns the global variables of the system.
+func globals(system *plugin.System) map[string]string {
+	var globals = map[string]string{}
+	for _, s := range system.Globals {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		globals[parts[0]] = parts[1]
+	}
+	return globals
+}
+
+// params returns the build parameters injected into
+// the Yaml prior to parsing.
+func params(payload *Payload) map[string]string {
+	params := map[string]string{
+		"COMMIT_SHORT": payload.Build.Commit, // DEPRECATED
+		"COMMIT":       payload.Build.Commit,
+		"BRANCH":       payload.Build.Branch,
+		"BUILD_NUMBER": strconv.Itoa(payload.Build.Number),
+	}
+	if payload.Build.Event == plugin.EventTag {
+		params["TAG"] = strings.TrimPrefix(payload.Build.Ref, "refs/tags/")
+	}
+	return params
+}
@@ -0,0 +1,108 @@
+package exec
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-exec/yaml/secure"
+	"github.com/drone/drone-plugin-go/plugin"
+	"github.com/franela/goblin"
+	"gopkg.in/yaml.v2"
+)
+
+func TestTree(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Execution tree", func() {
+
+		payload := func() Payload {
+			return Payload{
+				Yaml:   treeYaml,
+				Repo:   &plugin.Repo{FullName: "octocat/hello-world", Link: "https://github.com/octocat/hello-world", IsPrivate: true},
+				Build:  &plugin.Build{Event: plugin.EventPush, Branch: "master"},
+				Job:    &plugin.Job{},
+				System: &plugin.System{Globals: []string{"TOKEN=hunter2"}},
+			}
+		}
+
+		g.It("Should not inject global variables", func() {
+			tree, err := Tree(payload(), Options{})
+			g.Assert(err == nil).IsTrue()
+			out, _ := json.Marshal(tree)
+			g.Assert(strings.Contains(string(out), "hunter2")).IsFalse()
+			g.Assert(strings.Contains(string(out), "$$TOKEN")).IsTrue()
+		})
+
+		g.It("Should not fail on unresolved parameters", func() {
+			_, err := Tree(payload(), Options{Unresolved: "error"})
+			g.Assert(err == nil).IsTrue()
+		})
+
+		g.It("Should not report known secrets as unresolved", func() {
+			p := payload()
+			p.System.Globals = nil
+			_, err := load(&p, Options{Unresolved: "error"}, map[string]bool{"TOKEN": true})
+			g.Assert(err == nil).IsTrue()
+
+			p = payload()
+			p.System.Globals = nil
+			_, err = load(&p, Options{Unresolved: "error"}, nil)
+			g.Assert(err.Error()).Equal("yaml: line 5, column 12: unresolved parameter $$TOKEN")
+		})
+	})
+}
+
+func TestInjectSecrets(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Secret injection", func() {
+
+		sec := &secure.Secure{}
+		yaml.Unmarshal([]byte(scopedYaml), sec)
+
+		g.It("Should check the image of steps extending a template", func() {
+			payload := &Payload{
+				Yaml:  extendsYaml,
+				Repo:  &plugin.Repo{FullName: "octocat/hello-world"},
+				Build: &plugin.Build{Event: plugin.EventPush, Branch: "master"},
+			}
+			raw, err := injectSecrets(payload, sec, false, Options{})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(strings.Count(raw, "hunter2")).Equal(1)
+
+			conf := map[string]map[string]map[string]string{}
+			yaml.Unmarshal([]byte(raw), &conf)
+			g.Assert(conf["deploy"]["docker"]["password"]).Equal("$$PASSWORD")
+			g.Assert(conf["deploy"]["registry"]["password"]).Equal("hunter2")
+		})
+	})
+}
+
+var treeYaml = `
+build:
+  image: golang
+  commands:
+    - echo $$TOKEN
+`
+
+var scopedYaml = `
+environment:
+  PASSWORD:
+    value: hunter2
+    images: [ docker ]
+`
+
+var extendsYaml = `
+templates:
+  evil:
+    image: evil/exfiltrate
+
+deploy:
+  docker:
+    extends: evil
+    password: $$PASSWORD
+  registry:
+    image: docker
+    password: $$PASSWORD
+`
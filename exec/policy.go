@@ -0,0 +1,94 @@
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/drone/drone-plugin-go/plugin"
+)
+
+// SecretMode selects how secrets are injected into a build.
+type SecretMode string
+
+const (
+	// SecretsNormal injects secrets into the whole Yaml.
+	SecretsNormal SecretMode = "normal"
+
+	// SecretsSafe injects secrets except into the sections
+	// and fields protected by the safe policy.
+	SecretsSafe SecretMode = "safe"
+
+	// SecretsNone does not inject secrets.
+	SecretsNone SecretMode = "none"
+)
+
+// UnmarshalJSON unmarshals the secret mode, rejecting unknown
+// modes.
+func (m *SecretMode) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	switch mode := SecretMode(s); mode {
+	case SecretsNormal, SecretsSafe, SecretsNone:
+		*m = mode
+		return nil
+	}
+	return fmt.Errorf("unknown secret mode %q, expected normal, safe or none", s)
+}
+
+// injects returns true if secrets are injected in the mode.
+// Unknown modes do not inject secrets.
+func (m SecretMode) injects() bool {
+	return m == SecretsNormal || m == SecretsSafe
+}
+
+// Rule defines how secrets are injected, and whether the
+// deploy and notify steps stay enabled, for a kind of build.
+type Rule struct {
+	Secrets SecretMode `json:"secrets"`
+	Deploy  bool       `json:"deploy"`
+	Notify  bool       `json:"notify"`
+}
+
+// SecretPolicy defines the rule for each kind of build.
+type SecretPolicy struct {
+	Push Rule `json:"push"` // pushes, and other events
+	Tag  Rule `json:"tag"`  // tags
+	Pull Rule `json:"pull"` // pull requests from the same repository
+	Fork Rule `json:"fork"` // pull requests from a fork
+}
+
+// DefaultSecretPolicy injects secrets normally, except for
+// pull requests, which are injected safely whether or not they
+// are from a fork.
+var DefaultSecretPolicy = &SecretPolicy{
+	Push: Rule{Secrets: SecretsNormal, Deploy: true, Notify: true},
+	Tag:  Rule{Secrets: SecretsNormal, Deploy: true, Notify: true},
+	Pull: Rule{Secrets: SecretsSafe, Deploy: true, Notify: true},
+	Fork: Rule{Secrets: SecretsSafe, Deploy: true, Notify: true},
+}
+
+// Rule returns the rule for the build of the payload.
+func (p *SecretPolicy) Rule(payload *Payload) Rule {
+	switch payload.Build.Event {
+	case plugin.EventTag:
+		return p.Tag
+	case plugin.EventPull:
+		if isFork(payload) {
+			return p.Fork
+		}
+		return p.Pull
+	}
+	return p.Push
+}
+
+// isFork returns true if the pull request is opened from a
+// fork. Pull requests without a head repository are assumed
+// to be from a fork.
+func isFork(payload *Payload) bool {
+	return payload.HeadRepo == nil ||
+		payload.Repo == nil ||
+		payload.HeadRepo.FullName != payload.Repo.FullName
+}
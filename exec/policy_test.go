@@ -0,0 +1,75 @@
+package exec
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/drone/drone-plugin-go/plugin"
+	"github.com/franela/goblin"
+)
+
+func TestSecretPolicy(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Secret policy", func() {
+
+		repo := &plugin.Repo{FullName: "octocat/hello-world"}
+		fork := &plugin.Repo{FullName: "spaceghost/hello-world"}
+		policy := &SecretPolicy{
+			Push: Rule{Secrets: SecretsNormal, Deploy: true, Notify: true},
+			Tag:  Rule{Secrets: SecretsNormal, Deploy: true},
+			Pull: Rule{Secrets: SecretsSafe, Notify: true},
+			Fork: Rule{Secrets: SecretsNone},
+		}
+
+		g.It("Should select the rule for pushes and tags", func() {
+			payload := &Payload{Repo: repo, Build: &plugin.Build{Event: plugin.EventPush}}
+			g.Assert(policy.Rule(payload)).Equal(policy.Push)
+
+			payload.Build.Event = plugin.EventTag
+			g.Assert(policy.Rule(payload)).Equal(policy.Tag)
+		})
+
+		g.It("Should select the rule for pull requests", func() {
+			payload := &Payload{Repo: repo, HeadRepo: repo, Build: &plugin.Build{Event: plugin.EventPull}}
+			g.Assert(policy.Rule(payload)).Equal(policy.Pull)
+
+			payload.HeadRepo = fork
+			g.Assert(policy.Rule(payload)).Equal(policy.Fork)
+		})
+
+		g.It("Should assume pull requests without a head repository are from a fork", func() {
+			payload := &Payload{Repo: repo, Build: &plugin.Build{Event: plugin.EventPull}}
+			g.Assert(policy.Rule(payload)).Equal(policy.Fork)
+		})
+
+		g.It("Should inject secrets safely for pull requests by default", func() {
+			payload := &Payload{Repo: repo, HeadRepo: fork, Build: &plugin.Build{Event: plugin.EventPull}}
+			g.Assert(DefaultSecretPolicy.Rule(payload).Secrets).Equal(SecretsSafe)
+
+			payload.HeadRepo = repo
+			g.Assert(DefaultSecretPolicy.Rule(payload).Secrets).Equal(SecretsSafe)
+
+			payload.Build.Event = plugin.EventPush
+			g.Assert(DefaultSecretPolicy.Rule(payload).Secrets).Equal(SecretsNormal)
+		})
+
+		g.It("Should reject unknown secret modes", func() {
+			rule := Rule{}
+			err := json.Unmarshal([]byte(`{"secrets": "nromal"}`), &rule)
+			g.Assert(err.Error()).Equal(`unknown secret mode "nromal", expected normal, safe or none`)
+
+			err = json.Unmarshal([]byte(`{"secrets": "safe"}`), &rule)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(rule.Secrets).Equal(SecretsSafe)
+		})
+
+		g.It("Should not inject secrets in unknown modes", func() {
+			g.Assert(SecretsNormal.injects()).IsTrue()
+			g.Assert(SecretsSafe.injects()).IsTrue()
+			g.Assert(SecretsNone.injects()).IsFalse()
+			g.Assert(SecretMode("").injects()).IsFalse()
+			g.Assert(SecretMode("nromal").injects()).IsFalse()
+		})
+	})
+}
@@ -0,0 +1,39 @@
+package exec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/drone/drone-exec/runner"
+)
+
+// Report summarizes the execution of a build, including
+// the steps that were skipped and why.
+type Report struct {
+	Status   string         `json:"status"`
+	ExitCode int            `json:"exit_code"`
+	Skipped  []*runner.Skip `json:"skipped"`
+}
+
+// newReport returns the report of the build state.
+func newReport(state *runner.State) *Report {
+	report := &Report{
+		Status:   state.Job.Status,
+		ExitCode: state.ExitCode(),
+		Skipped:  []*runner.Skip{},
+	}
+	state.Lock()
+	report.Skipped = append(report.Skipped, state.Skipped...)
+	state.Unlock()
+	return report
+}
+
+// writeReport writes the JSON encoded report of the build
+// state to the file.
+func writeReport(file string, state *runner.State) error {
+	out, err := json.MarshalIndent(newReport(state), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(out, '\n'), 0644)
+}
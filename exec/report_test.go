@@ -0,0 +1,53 @@
+package exec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-exec/runner"
+	"github.com/drone/drone-plugin-go/plugin"
+	"github.com/franela/goblin"
+)
+
+func TestReport(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Build report", func() {
+
+		g.It("Should report the skipped steps", func() {
+			dir, _ := ioutil.TempDir("", "report")
+			defer os.RemoveAll(dir)
+			file := filepath.Join(dir, "report.json")
+
+			state := &runner.State{
+				Job:   &plugin.Job{Status: plugin.StateSuccess},
+				Build: &plugin.Build{},
+			}
+			state.Skip(&runner.Skip{Step: "deploy/heroku", Field: "branch", Want: "[master]", Got: "feature/x"})
+			g.Assert(writeReport(file, state) == nil).IsTrue()
+
+			raw, _ := ioutil.ReadFile(file)
+			report := map[string]interface{}{}
+			json.Unmarshal(raw, &report)
+			g.Assert(report["status"]).Equal("success")
+			g.Assert(report["exit_code"]).Equal(float64(0))
+			g.Assert(report["skipped"]).Equal([]interface{}{
+				map[string]interface{}{
+					"step":  "deploy/heroku",
+					"field": "branch",
+					"want":  "[master]",
+					"got":   "feature/x",
+				},
+			})
+		})
+
+		g.It("Should report no skipped steps as an empty list", func() {
+			state := &runner.State{Job: &plugin.Job{Status: plugin.StateFailure, ExitCode: 1}}
+			out, _ := json.Marshal(newReport(state))
+			g.Assert(string(out)).Equal(`{"status":"failure","exit_code":1,"skipped":[]}`)
+		})
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/drone/drone-exec/yaml"
+)
+
+// lint reads the Yaml configuration files, or .drone.yml
+// if none are provided, and writes the problems found to
+// stdout. It exits with a non-zero code if errors are found.
+func lint(files []string) {
+	if len(files) == 0 {
+		files = []string{".drone.yml"}
+	}
+
+	var failed bool
+	for _, file := range files {
+		in, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, d := range yaml.Lint(in) {
+			fmt.Printf("%s:%s\n", file, d)
+			if d.Severity == yaml.SeverityError {
+				failed = true
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
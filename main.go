@@ -2,12 +2,16 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 
 	"github.com/drone/drone-exec/exec"
 	"github.com/drone/drone-exec/yaml"
+	"github.com/drone/drone-exec/yaml/inject"
+	"github.com/drone/drone-exec/yaml/secure"
 	"github.com/drone/drone-plugin-go/plugin"
 
 	log "github.com/Sirupsen/logrus"
@@ -24,9 +28,91 @@ func main() {
 	flag.BoolVar(&opt.Notify, "notify", false, "")
 	flag.BoolVar(&opt.Debug, "debug", false, "")
 	flag.BoolVar(&opt.Force, "pull", false, "")
+	flag.BoolVar(&opt.Strict, "strict", false, "")
 	flag.StringVar(&opt.Mount, "mount", "", "")
+	flag.StringVar(&opt.IncludeDir, "include-dir", "", "")
+	flag.StringVar(&opt.WorkspaceRoot, "workspace-root", "", "")
+	flag.StringVar(&opt.WorkspacePath, "workspace-path", "", "")
+	flag.StringVar(&opt.Unresolved, "unresolved", "", "")
+	flag.BoolVar(&opt.RequireSignature, "require-signature", false, "")
+	flag.StringVar(&opt.Report, "report", "", "")
+	secretsPath := flag.String("secrets", "", "")
+	secretsURL := flag.String("secrets-url", "", "")
+	secretsToken := flag.String("secrets-token", os.Getenv("DRONE_SECRETS_TOKEN"), "")
+	secretPolicy := flag.String("secret-policy", "", "")
+	safePolicy := flag.String("safe-policy", "", "")
 	flag.Parse()
 
+	if len(*secretPolicy) != 0 {
+		opt.SecretPolicy = loadSecretPolicy(*secretPolicy)
+	}
+	if len(*safePolicy) != 0 {
+		opt.SafePolicy = loadSafePolicy(*safePolicy)
+	}
+
+	switch {
+	case len(*secretsPath) != 0:
+		opt.Secrets = secure.NewFileProvider(*secretsPath)
+	case len(*secretsURL) != 0:
+		opt.Secrets = secure.NewHTTPProvider(*secretsURL, *secretsToken)
+	}
+
+	switch flag.Arg(0) {
+	case "tree":
+		tree(opt)
+	case "lint":
+		lint(flag.Args()[1:])
+	case "migrate":
+		migrate(flag.Args()[1:])
+	case "schema":
+		schema()
+	case "secure":
+		secureCmd(flag.Args()[1:])
+	default:
+		run(opt)
+	}
+}
+
+// loadSecretPolicy reads the secret policy from a JSON file.
+// Rules missing from the file are taken from the default policy.
+func loadSecretPolicy(file string) *exec.SecretPolicy {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	policy := *exec.DefaultSecretPolicy
+	err = json.Unmarshal(raw, &policy)
+	if err != nil {
+		log.Fatalf("parsing secret policy %s: %s", file, err)
+	}
+	return &policy
+}
+
+// loadSafePolicy reads the safe injection policy from a JSON
+// file. Sections or fields missing from the file are taken
+// from the default policy.
+func loadSafePolicy(file string) *inject.Policy {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	policy := inject.Policy{}
+	err = json.Unmarshal(raw, &policy)
+	if err != nil {
+		log.Fatalf("parsing safe policy %s: %s", file, err)
+	}
+	if policy.Sections == nil {
+		policy.Sections = inject.DefaultPolicy.Sections
+	}
+	if policy.Fields == nil {
+		policy.Fields = inject.DefaultPolicy.Fields
+	}
+	return &policy
+}
+
+// run executes the build.
+func run(opt exec.Options) {
+
 	// unmarshal the json payload via stdin or
 	// via the command line args (whichever was used)
 	var payload exec.Payload
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/drone/drone-exec/yaml"
+)
+
+// migrate upgrades the Yaml configuration files, or .drone.yml
+// if none are provided, to the current version of the format,
+// rewriting each file in place.
+func migrate(files []string) {
+	if len(files) == 0 {
+		files = []string{".drone.yml"}
+	}
+
+	for _, file := range files {
+		in, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		out, err := yaml.Migrate(in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			os.Exit(1)
+		}
+		if bytes.Equal(in, out) {
+			fmt.Printf("%s: already at version %d\n", file, yaml.Version)
+			continue
+		}
+		err = ioutil.WriteFile(file, out, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: migrated to version %d\n", file, yaml.Version)
+	}
+}
@@ -0,0 +1,97 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestExpr(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("When expressions", func() {
+
+		vars := map[string]string{
+			"branch":            "master",
+			"event":             "push",
+			"matrix.GO_VERSION": "1.5",
+		}
+
+		g.It("Should evaluate comparisons", func() {
+			g.Assert(eval("branch == 'master'", vars)).IsTrue()
+			g.Assert(eval("branch != 'master'", vars)).IsFalse()
+			g.Assert(eval(`event == "tag"`, vars)).IsFalse()
+		})
+
+		g.It("Should evaluate boolean operators", func() {
+			g.Assert(eval("branch == 'master' && (event == 'push' || event == 'tag')", vars)).IsTrue()
+			g.Assert(eval("branch == 'dev' || event == 'push'", vars)).IsTrue()
+			g.Assert(eval("!(event == 'push')", vars)).IsFalse()
+			g.Assert(eval("true && !false", vars)).IsTrue()
+		})
+
+		g.It("Should evaluate functions", func() {
+			g.Assert(eval("!matrix.GO_VERSION.startsWith('1.4')", vars)).IsTrue()
+			g.Assert(eval("branch.endsWith('ter')", vars)).IsTrue()
+			g.Assert(eval("branch.contains('ast')", vars)).IsTrue()
+			g.Assert(eval("branch.matches('^(master|release/.*)$')", vars)).IsTrue()
+		})
+
+		g.It("Should evaluate missing variables as empty", func() {
+			g.Assert(eval("matrix.NODE_VERSION == ''", vars)).IsTrue()
+		})
+
+		g.It("Should handle escaped quotes", func() {
+			g.Assert(eval(`'it\'s' == "it's"`, vars)).IsTrue()
+		})
+
+		g.It("Should report syntax errors with a column", func() {
+			_, err := Parse("branch == 'master' &&")
+			g.Assert(err.Error()).Equal("unexpected end of expression at column 22")
+
+			_, err = Parse("branch = 'master'")
+			g.Assert(err.Error()).Equal("unexpected character '=' at column 8")
+
+			_, err = Parse("(branch == 'master'")
+			g.Assert(err.Error()).Equal("expected ), found end of expression at column 20")
+
+			_, err = Parse("branch == 'master")
+			g.Assert(err.Error()).Equal("unterminated string at column 11")
+		})
+
+		g.It("Should report unknown variables and functions", func() {
+			_, err := Parse("brnch == 'master'")
+			g.Assert(err.Error()).Equal("unknown variable brnch, expected one of repo, branch, event, status, previous, ref, commit or matrix.NAME at column 1")
+
+			_, err = Parse("branch.hasPrefix('m')")
+			g.Assert(err.Error()).Equal("unknown function hasPrefix at column 8")
+		})
+
+		g.It("Should report type errors", func() {
+			_, err := Parse("branch")
+			g.Assert(err.Error()).Equal("expression must evaluate to a boolean, got a string at column 1")
+
+			_, err = Parse("branch && true")
+			g.Assert(err.Error()).Equal("operator && requires boolean operands at column 8")
+
+			_, err = Parse("branch == true")
+			g.Assert(err.Error()).Equal("cannot compare string with boolean at column 8")
+
+			_, err = Parse("branch.startsWith('a', 'b')")
+			g.Assert(err.Error()).Equal("function startsWith expects 1 argument, got 2 at column 8")
+		})
+
+		g.It("Should report invalid regular expressions", func() {
+			_, err := Parse("branch.matches('[')")
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
+
+func eval(src string, vars map[string]string) bool {
+	e, err := Parse(src)
+	if err != nil {
+		panic(err)
+	}
+	return e.Eval(vars)
+}
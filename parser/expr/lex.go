@@ -0,0 +1,134 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenType identifies the type of lexical tokens.
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdent
+	tokenString
+	tokenDot
+	tokenComma
+	tokenLparen
+	tokenRparen
+	tokenNot
+	tokenAnd
+	tokenOr
+	tokenEq
+	tokenNeq
+)
+
+// token represents a token returned from the scanner.
+type token struct {
+	typ tokenType
+	pos int    // column of the token, starting at 1
+	val string // raw value of the token
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.val)
+	case tokenIdent:
+		return fmt.Sprintf("identifier %q", t.val)
+	}
+	return fmt.Sprintf("%q", t.val)
+}
+
+// lex scans the expression and returns the list of
+// tokens, terminated by a tokenEOF token.
+func lex(in string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(in); {
+		c := in[i]
+		pos := i + 1
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '.':
+			tokens = append(tokens, token{tokenDot, pos, "."})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, pos, ","})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLparen, pos, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRparen, pos, ")"})
+			i++
+		case strings.HasPrefix(in[i:], "&&"):
+			tokens = append(tokens, token{tokenAnd, pos, "&&"})
+			i += 2
+		case strings.HasPrefix(in[i:], "||"):
+			tokens = append(tokens, token{tokenOr, pos, "||"})
+			i += 2
+		case strings.HasPrefix(in[i:], "=="):
+			tokens = append(tokens, token{tokenEq, pos, "=="})
+			i += 2
+		case strings.HasPrefix(in[i:], "!="):
+			tokens = append(tokens, token{tokenNeq, pos, "!="})
+			i += 2
+		case c == '!':
+			tokens = append(tokens, token{tokenNot, pos, "!"})
+			i++
+		case c == '\'' || c == '"':
+			val, n, err := lexString(in[i:], pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, pos, val})
+			i += n
+		case isIdentStart(rune(c)):
+			n := 1
+			for i+n < len(in) && isIdentChar(rune(in[i+n])) {
+				n++
+			}
+			tokens = append(tokens, token{tokenIdent, pos, in[i : i+n]})
+			i += n
+		default:
+			return nil, errorf(pos, "unexpected character %q", c)
+		}
+	}
+	tokens = append(tokens, token{tokenEOF, len(in) + 1, ""})
+	return tokens, nil
+}
+
+// lexString scans a quoted string literal and returns the
+// unquoted value and the number of bytes consumed. A
+// backslash escapes the next character.
+func lexString(in string, pos int) (string, int, error) {
+	quote := in[0]
+	var buf []byte
+	for i := 1; i < len(in); i++ {
+		switch in[i] {
+		case '\\':
+			if i+1 == len(in) {
+				break
+			}
+			i++
+			buf = append(buf, in[i])
+		case quote:
+			return string(buf), i + 1, nil
+		default:
+			buf = append(buf, in[i])
+		}
+	}
+	return "", 0, errorf(pos, "unterminated string")
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentChar(r rune) bool {
+	return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,102 @@
+package expr
+
+import (
+	"regexp"
+	"strings"
+)
+
+// kind identifies the type of value produced by a node.
+type kind int
+
+const (
+	kindString kind = iota
+	kindBool
+)
+
+func (k kind) String() string {
+	if k == kindBool {
+		return "boolean"
+	}
+	return "string"
+}
+
+// node is an element in the expression tree.
+type node interface {
+	kind() kind
+	eval(vars map[string]string) interface{}
+}
+
+// funcs defines the functions that may be called on
+// string values.
+var funcs = map[string]func(s, arg string) bool{
+	"startsWith": strings.HasPrefix,
+	"endsWith":   strings.HasSuffix,
+	"contains":   strings.Contains,
+	"matches":    matches,
+}
+
+// matches reports whether the string contains a match of
+// the regular expression. Invalid patterns never match.
+func matches(s, pattern string) bool {
+	re, err := regexp.Compile(pattern)
+	return err == nil && re.MatchString(s)
+}
+
+type stringNode struct{ val string }
+
+func (n *stringNode) kind() kind                         { return kindString }
+func (n *stringNode) eval(map[string]string) interface{} { return n.val }
+
+type boolNode struct{ val bool }
+
+func (n *boolNode) kind() kind                         { return kindBool }
+func (n *boolNode) eval(map[string]string) interface{} { return n.val }
+
+type varNode struct{ name string }
+
+func (n *varNode) kind() kind { return kindString }
+func (n *varNode) eval(vars map[string]string) interface{} {
+	return vars[n.name]
+}
+
+type notNode struct{ node node }
+
+func (n *notNode) kind() kind { return kindBool }
+func (n *notNode) eval(vars map[string]string) interface{} {
+	return !n.node.eval(vars).(bool)
+}
+
+type andNode struct{ left, right node }
+
+func (n *andNode) kind() kind { return kindBool }
+func (n *andNode) eval(vars map[string]string) interface{} {
+	return n.left.eval(vars).(bool) && n.right.eval(vars).(bool)
+}
+
+type orNode struct{ left, right node }
+
+func (n *orNode) kind() kind { return kindBool }
+func (n *orNode) eval(vars map[string]string) interface{} {
+	return n.left.eval(vars).(bool) || n.right.eval(vars).(bool)
+}
+
+type compareNode struct {
+	left, right node
+	negate      bool
+}
+
+func (n *compareNode) kind() kind { return kindBool }
+func (n *compareNode) eval(vars map[string]string) interface{} {
+	return (n.left.eval(vars) == n.right.eval(vars)) != n.negate
+}
+
+type callNode struct {
+	fn   func(s, arg string) bool
+	recv node
+	arg  node
+}
+
+func (n *callNode) kind() kind { return kindBool }
+func (n *callNode) eval(vars map[string]string) interface{} {
+	return n.fn(n.recv.eval(vars).(string), n.arg.eval(vars).(string))
+}
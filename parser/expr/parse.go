@@ -0,0 +1,301 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Error reports an error parsing an expression.
+type Error struct {
+	Pos int    // column where the error occurred
+	Msg string // description of the error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Pos)
+}
+
+func errorf(pos int, format string, args ...interface{}) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Vars lists the variables that may be referenced in an
+// expression. Matrix parameters are referenced using the
+// matrix prefix, for example matrix.GO_VERSION.
+var Vars = []string{
+	"repo",
+	"branch",
+	"event",
+	"status",
+	"previous",
+	"ref",
+	"commit",
+}
+
+// Expr is a parsed boolean expression.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse parses the expression. An error is returned if the
+// expression is malformed, references an unknown variable
+// or function, or does not evaluate to a boolean value.
+func Parse(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.typ != tokenEOF {
+		return nil, errorf(tok.pos, "unexpected %s", tok)
+	}
+	if root.kind() != kindBool {
+		return nil, errorf(1, "expression must evaluate to a boolean, got a string")
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression using the variable values.
+// Missing variables evaluate to an empty string.
+func (e *Expr) Eval(vars map[string]string) bool {
+	return e.root.eval(vars).(bool)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.typ != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) expect(typ tokenType, what string) (token, error) {
+	tok := p.next()
+	if tok.typ != typ {
+		return tok, errorf(tok.pos, "expected %s, found %s", what, tok)
+	}
+	return tok, nil
+}
+
+// parseOr parses a sequence of expressions joined by ||.
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokenOr {
+		op := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBool(op, left, right); err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+// parseAnd parses a sequence of expressions joined by &&.
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokenAnd {
+		op := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBool(op, left, right); err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+// parseUnary parses an optionally negated comparison.
+func (p *parser) parseUnary() (node, error) {
+	if p.peek().typ != tokenNot {
+		return p.parseCompare()
+	}
+	op := p.next()
+	n, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBool(op, n); err != nil {
+		return nil, err
+	}
+	return &notNode{n}, nil
+}
+
+// parseCompare parses an optional == or != comparison.
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	if tok.typ != tokenEq && tok.typ != tokenNeq {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	if left.kind() != right.kind() {
+		return nil, errorf(tok.pos, "cannot compare %s with %s", left.kind(), right.kind())
+	}
+	return &compareNode{left, right, tok.typ == tokenNeq}, nil
+}
+
+// parsePostfix parses a value followed by zero or more
+// function calls, for example branch.startsWith('feature/').
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokenDot {
+		p.next()
+		name, err := p.expect(tokenIdent, "function name")
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().typ != tokenLparen {
+			return nil, errorf(name.pos, "expected ( after function %s", name.val)
+		}
+		n, err = p.parseCall(n, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// parseCall parses the arguments of a function call on
+// the receiver value.
+func (p *parser) parseCall(recv node, name token) (node, error) {
+	fn, ok := funcs[name.val]
+	if !ok {
+		return nil, errorf(name.pos, "unknown function %s", name.val)
+	}
+	if recv.kind() != kindString {
+		return nil, errorf(name.pos, "function %s requires a string, got a boolean", name.val)
+	}
+	p.next() // consume the (
+
+	var args []node
+	for p.peek().typ != tokenRparen {
+		if len(args) != 0 {
+			if _, err := p.expect(tokenComma, ", or )"); err != nil {
+				return nil, err
+			}
+		}
+		tok := p.peek()
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if arg.kind() != kindString {
+			return nil, errorf(tok.pos, "function %s requires string arguments", name.val)
+		}
+		args = append(args, arg)
+	}
+	p.next() // consume the )
+
+	if len(args) != 1 {
+		return nil, errorf(name.pos, "function %s expects 1 argument, got %d", name.val, len(args))
+	}
+	call := &callNode{fn: fn, recv: recv, arg: args[0]}
+
+	// regular expressions are compiled while parsing so
+	// that errors are reported before the build starts.
+	if lit, ok := args[0].(*stringNode); ok && name.val == "matches" {
+		re, err := regexp.Compile(lit.val)
+		if err != nil {
+			return nil, errorf(name.pos, "invalid regular expression %q: %s", lit.val, err)
+		}
+		call.fn = func(s, _ string) bool { return re.MatchString(s) }
+	}
+	return call, nil
+}
+
+// parsePrimary parses a literal, a variable or an
+// expression enclosed in parenthesis.
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.typ {
+	case tokenString:
+		return &stringNode{tok.val}, nil
+	case tokenLparen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRparen, ")"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case tokenIdent:
+		switch tok.val {
+		case "true":
+			return &boolNode{true}, nil
+		case "false":
+			return &boolNode{false}, nil
+		case "matrix":
+			if _, err := p.expect(tokenDot, ". after matrix"); err != nil {
+				return nil, err
+			}
+			key, err := p.expect(tokenIdent, "matrix parameter name")
+			if err != nil {
+				return nil, err
+			}
+			return &varNode{"matrix." + key.val}, nil
+		}
+		for _, name := range Vars {
+			if name == tok.val {
+				return &varNode{name}, nil
+			}
+		}
+		return nil, errorf(tok.pos, "unknown variable %s, expected one of %s or matrix.NAME",
+			tok.val, strings.Join(Vars, ", "))
+	}
+	return nil, errorf(tok.pos, "unexpected %s", tok)
+}
+
+// checkBool returns an error if any of the operands
+// do not evaluate to a boolean value.
+func checkBool(op token, operands ...node) error {
+	for _, n := range operands {
+		if n.kind() != kindBool {
+			return errorf(op.pos, "operator %s requires boolean operands", op.val)
+		}
+	}
+	return nil
+}
@@ -24,6 +24,11 @@ const (
 // the parsing process.
 type RuleFunc func(Node) error
 
+// TreeRuleFunc defines a function used to validate or modify the complete
+// tree once it is constructed. Tree rules may enforce invariants across
+// steps, and reorder or inject nodes.
+type TreeRuleFunc func(*Tree) error
+
 // ImageName expands to a fully qualified image name. If no image name is found,
 // a default is used when possible, else ErrImageMissing is returned.
 func ImageName(n Node) error {
@@ -115,10 +120,11 @@ func ImagePullFunc(pull bool) RuleFunc {
 }
 
 // Sanitize sanitizes a Docker Node by removing any potentially
-// harmful configuration options.
+// harmful configuration options. Mandatory nodes are defined by
+// the system and are not sanitized.
 func Sanitize(n Node) error {
 	d, ok := n.(*DockerNode)
-	if !ok {
+	if !ok || d.Mandatory {
 		return nil
 	}
 	d.Privileged = false
@@ -261,6 +267,44 @@ func MountFunc(from, to string) RuleFunc {
 	}
 }
 
+// PrivilegedLimitFunc returns a tree rule that limits the number of steps
+// running in privileged mode.
+func PrivilegedLimitFunc(limit int) TreeRuleFunc {
+	return func(t *Tree) error {
+		var count int
+		for _, d := range t.Steps() {
+			if d.Privileged {
+				count++
+			}
+		}
+		if count > limit {
+			return fmt.Errorf("Yaml must specify at most %d privileged steps, found %d", limit, count)
+		}
+		return nil
+	}
+}
+
+// RequireFunc returns a tree rule that requires a step of type dep if
+// the tree contains a step of type typ. For example, a deploy step
+// may require a publish step.
+func RequireFunc(typ, dep NodeType) TreeRuleFunc {
+	return func(t *Tree) error {
+		var found, required bool
+		for _, d := range t.Steps() {
+			switch {
+			case d.NodeType == typ:
+				found = true
+			case d.NodeType == dep && len(d.Image) != 0:
+				required = true
+			}
+		}
+		if found && !required {
+			return fmt.Errorf("Yaml must specify a %s step when using %s steps", dep, typ)
+		}
+		return nil
+	}
+}
+
 // expandImage expands an alias plugin name to use a
 // fully qualified image name.
 func expandImage(image string) string {
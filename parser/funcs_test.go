@@ -1 +1,45 @@
 package parser
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestRules(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Tree rules", func() {
+
+		g.It("Should limit privileged steps", func() {
+			tree, _ := Parse(privilegedYaml, nil)
+			g.Assert(PrivilegedLimitFunc(2)(tree) == nil).IsTrue()
+			err := PrivilegedLimitFunc(1)(tree)
+			g.Assert(err.Error()).Equal("Yaml must specify at most 1 privileged steps, found 2")
+		})
+
+		g.It("Should require a dependent step", func() {
+			tree, _ := Parse(privilegedYaml, nil)
+			g.Assert(RequireFunc(NodeDeploy, NodePublish)(tree) == nil).IsTrue()
+			err := RequireFunc(NodePublish, NodeDeploy)(tree)
+			g.Assert(err.Error()).Equal("Yaml must specify a deploy step when using publish steps")
+		})
+
+		g.It("Should apply tree rules after node rules", func() {
+			_, err := Parse(privilegedYaml, []RuleFunc{Sanitize}, PrivilegedLimitFunc(0))
+			g.Assert(err == nil).IsTrue()
+		})
+	})
+}
+
+var privilegedYaml = `
+build:
+  image: golang
+  privileged: true
+  commands:
+    - go test
+
+publish:
+  docker:
+    privileged: true
+`
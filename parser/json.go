@@ -0,0 +1,302 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/drone/drone-exec/parser/expr"
+	"github.com/drone/drone-exec/yaml"
+)
+
+// listJSON is the serialized form of a ListNode.
+type listJSON struct {
+	Type  string            `json:"type"`
+	Nodes []json.RawMessage `json:"nodes"`
+}
+
+// filterJSON is the serialized form of a FilterNode.
+type filterJSON struct {
+	Type    string            `json:"type"`
+	Repo    string            `json:"repo,omitempty"`
+	Branch  []string          `json:"branch,omitempty"`
+	Tag     []string          `json:"tag,omitempty"`
+	Event   []string          `json:"event,omitempty"`
+	Success string            `json:"success,omitempty"`
+	Failure string            `json:"failure,omitempty"`
+	Change  string            `json:"change,omitempty"`
+	Matrix  map[string]string `json:"matrix,omitempty"`
+	Expr    string            `json:"expr,omitempty"`
+	Node    json.RawMessage   `json:"node,omitempty"`
+}
+
+// dockerJSON is the serialized form of a DockerNode. The
+// registry password and token, and the environment variable
+// values, are omitted since they may contain secrets.
+type dockerJSON struct {
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name,omitempty"`
+	Image       string                 `json:"image"`
+	Pull        bool                   `json:"pull,omitempty"`
+	Privileged  bool                   `json:"privileged,omitempty"`
+	Environment []string               `json:"environment,omitempty"`
+	Entrypoint  []string               `json:"entrypoint,omitempty"`
+	Command     []string               `json:"command,omitempty"`
+	Commands    []string               `json:"commands,omitempty"`
+	Shell       []string               `json:"shell,omitempty"`
+	Volumes     []string               `json:"volumes,omitempty"`
+	ExtraHosts  []string               `json:"extra_hosts,omitempty"`
+	Net         string                 `json:"net,omitempty"`
+	AuthConfig  *authJSON              `json:"auth_config,omitempty"`
+	Secrets     []*secretJSON          `json:"secrets,omitempty"`
+	Vargs       map[string]interface{} `json:"vargs,omitempty"`
+	Mandatory   bool                   `json:"mandatory,omitempty"`
+}
+
+// secretJSON is the serialized form of a SecretFile. The
+// value is omitted.
+type secretJSON struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+type authJSON struct {
+	Username string `json:"username,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
+// MarshalJSON returns the JSON encoding of the tree.
+func (t *Tree) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Root)
+}
+
+// MarshalJSON returns the JSON encoding of the list node.
+func (l *ListNode) MarshalJSON() ([]byte, error) {
+	out := listJSON{Type: l.NodeType.String(), Nodes: []json.RawMessage{}}
+	for _, n := range l.Nodes {
+		raw, err := json.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+		out.Nodes = append(out.Nodes, raw)
+	}
+	return json.Marshal(out)
+}
+
+// MarshalJSON returns the JSON encoding of the filter node.
+func (f *FilterNode) MarshalJSON() ([]byte, error) {
+	out := filterJSON{
+		Type:    f.NodeType.String(),
+		Repo:    f.Repo,
+		Branch:  f.Branch,
+		Tag:     f.Tag,
+		Event:   f.Event,
+		Success: f.Success,
+		Failure: f.Failure,
+		Change:  f.Change,
+		Matrix:  f.Matrix,
+	}
+	if f.Expr != nil {
+		out.Expr = f.Expr.String()
+	}
+	if f.Node != nil {
+		raw, err := json.Marshal(f.Node)
+		if err != nil {
+			return nil, err
+		}
+		out.Node = raw
+	}
+	return json.Marshal(out)
+}
+
+// MarshalJSON returns the JSON encoding of the docker node.
+func (d *DockerNode) MarshalJSON() ([]byte, error) {
+	out := dockerJSON{
+		Type:       d.NodeType.String(),
+		Name:       d.Name,
+		Image:      d.Image,
+		Pull:       d.Pull,
+		Privileged: d.Privileged,
+		Entrypoint: d.Entrypoint,
+		Command:    d.Command,
+		Commands:   d.Commands,
+		Shell:      d.Shell,
+		Volumes:    d.Volumes,
+		ExtraHosts: d.ExtraHosts,
+		Net:        d.Net,
+		Mandatory:  d.Mandatory,
+	}
+	for _, file := range d.Secrets {
+		out.Secrets = append(out.Secrets, &secretJSON{file.Source, file.Target})
+	}
+	for _, env := range d.Environment {
+		out.Environment = append(out.Environment, strings.SplitN(env, "=", 2)[0])
+	}
+	if len(d.AuthConfig.Username) != 0 || len(d.AuthConfig.Email) != 0 {
+		out.AuthConfig = &authJSON{
+			Username: d.AuthConfig.Username,
+			Email:    d.AuthConfig.Email,
+		}
+	}
+	if len(d.Vargs) != 0 {
+		out.Vargs = jsonMap(d.Vargs)
+	}
+	return json.Marshal(out)
+}
+
+// Unmarshal parses the JSON encoding of a tree.
+func Unmarshal(data []byte) (*Tree, error) {
+	root, err := unmarshalNode(data)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := root.(*ListNode)
+	if !ok {
+		return nil, fmt.Errorf("Tree root must be a list node, got %s", root.Type())
+	}
+	return &Tree{Root: list}, nil
+}
+
+// unmarshalNode parses the JSON encoding of a node, using
+// the type name to select the node implementation.
+func unmarshalNode(data []byte) (Node, error) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	err := json.Unmarshal(data, &head)
+	if err != nil {
+		return nil, err
+	}
+	typ, ok := parseNodeType(head.Type)
+	if !ok {
+		return nil, fmt.Errorf("Unknown node type %q", head.Type)
+	}
+
+	switch typ {
+	case NodeList:
+		in := listJSON{}
+		err := json.Unmarshal(data, &in)
+		if err != nil {
+			return nil, err
+		}
+		node := newListNode()
+		for _, raw := range in.Nodes {
+			child, err := unmarshalNode(raw)
+			if err != nil {
+				return nil, err
+			}
+			node.append(child)
+		}
+		return node, nil
+
+	case NodeFilter:
+		in := filterJSON{}
+		err := json.Unmarshal(data, &in)
+		if err != nil {
+			return nil, err
+		}
+		node := &FilterNode{
+			NodeType: NodeFilter,
+			Repo:     in.Repo,
+			Branch:   in.Branch,
+			Tag:      in.Tag,
+			Event:    in.Event,
+			Success:  in.Success,
+			Failure:  in.Failure,
+			Change:   in.Change,
+			Matrix:   in.Matrix,
+		}
+		err = node.compile()
+		if err != nil {
+			return nil, err
+		}
+		if len(in.Expr) != 0 {
+			node.Expr, err = expr.Parse(in.Expr)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing when expression %q. %s", in.Expr, err)
+			}
+		}
+		if len(in.Node) != 0 {
+			node.Node, err = unmarshalNode(in.Node)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return node, nil
+	}
+
+	in := dockerJSON{}
+	err = json.Unmarshal(data, &in)
+	if err != nil {
+		return nil, err
+	}
+	node := &DockerNode{
+		NodeType:    typ,
+		Name:        in.Name,
+		Image:       in.Image,
+		Pull:        in.Pull,
+		Privileged:  in.Privileged,
+		Environment: in.Environment,
+		Entrypoint:  in.Entrypoint,
+		Command:     in.Command,
+		Commands:    in.Commands,
+		Shell:       in.Shell,
+		Volumes:     in.Volumes,
+		ExtraHosts:  in.ExtraHosts,
+		Net:         in.Net,
+		Vargs:       in.Vargs,
+		Mandatory:   in.Mandatory,
+	}
+	for _, file := range in.Secrets {
+		node.Secrets = append(node.Secrets, &SecretFile{Source: file.Source, Target: file.Target})
+	}
+	if in.AuthConfig != nil {
+		node.AuthConfig = yaml.AuthConfig{
+			Username: in.AuthConfig.Username,
+			Email:    in.AuthConfig.Email,
+		}
+	}
+	return node, nil
+}
+
+// parseNodeType returns the node type with the given name.
+func parseNodeType(name string) (NodeType, bool) {
+	for typ, typName := range nodeNames {
+		if typName == name {
+			return typ, true
+		}
+	}
+	return 0, false
+}
+
+// jsonMap converts the plugin arguments to a structure that
+// can be encoded as JSON. Nested Yaml maps are decoded with
+// interface{} keys, which are not supported by the JSON
+// encoder.
+func jsonMap(in map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range in {
+		out[k] = jsonValue(v)
+	}
+	return out
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		out := map[string]interface{}{}
+		for k, vv := range v {
+			out[fmt.Sprint(k)] = jsonValue(vv)
+		}
+		return out
+	case map[string]interface{}:
+		return jsonMap(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, vv := range v {
+			out[i] = jsonValue(vv)
+		}
+		return out
+	}
+	return v
+}
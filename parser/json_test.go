@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestJSON(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Tree serialization", func() {
+
+		g.It("Should encode node type names", func() {
+			tree, _ := Parse(jsonYaml, []RuleFunc{ImageName})
+			out, err := json.Marshal(tree)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(strings.Contains(string(out), `"type":"list"`)).IsTrue()
+			g.Assert(strings.Contains(string(out), `"type":"filter"`)).IsTrue()
+			g.Assert(strings.Contains(string(out), `"type":"deploy","name":"heroku","image":"plugins/drone-heroku:latest"`)).IsTrue()
+		})
+
+		g.It("Should omit secrets", func() {
+			tree, _ := Parse(jsonYaml, nil)
+			out, _ := json.Marshal(tree)
+			g.Assert(strings.Contains(string(out), "hunter2")).IsFalse()
+			g.Assert(strings.Contains(string(out), "s3cr3t")).IsFalse()
+			g.Assert(strings.Contains(string(out), `"environment":["GOPATH"]`)).IsTrue()
+			g.Assert(strings.Contains(string(out), `"auth_config":{"username":"octocat"}`)).IsTrue()
+		})
+
+		g.It("Should omit secret file values", func() {
+			tree, _ := Parse(jsonYaml, nil)
+			var build *DockerNode
+			for _, step := range tree.Steps() {
+				if step.NodeType == NodeBuild {
+					build = step
+				}
+			}
+			g.Assert(build.Secrets[0].Target).Equal("/run/secrets/ssh_key")
+			g.Assert(build.Secrets[1].Target).Equal("/root/.netrc")
+			g.Assert(build.Shell).Equal([]string{"bash"})
+
+			build.Secrets[0].Value = "hunter2"
+			out, _ := json.Marshal(tree)
+			g.Assert(strings.Contains(string(out), "hunter2")).IsFalse()
+			g.Assert(strings.Contains(string(out), `"secrets":[{"source":"ssh_key","target":"/run/secrets/ssh_key"}`)).IsTrue()
+		})
+
+		g.It("Should round-trip the tree", func() {
+			tree, _ := Parse(jsonYaml, nil)
+			before, _ := json.Marshal(tree)
+			decoded, err := Unmarshal(before)
+			g.Assert(err == nil).IsTrue()
+			after, _ := json.Marshal(decoded)
+			g.Assert(string(after)).Equal(string(before))
+
+			filter := decoded.Root.Nodes[2].(*FilterNode)
+			g.Assert(filter.Branch).Equal([]string{"master"})
+			g.Assert(filter.Expr.String()).Equal("event == 'push'")
+			g.Assert(filter.Node.(*DockerNode).Vargs["app"]).Equal("foo.com")
+		})
+
+		g.It("Should reject unknown node types", func() {
+			_, err := Unmarshal([]byte(`{"type":"list","nodes":[{"type":"bogus"}]}`))
+			g.Assert(err.Error()).Equal(`Unknown node type "bogus"`)
+		})
+	})
+}
+
+var jsonYaml = `
+build:
+  image: golang
+  shell: bash
+  environment:
+    - GOPATH=/s3cr3t
+  auth_config:
+    username: octocat
+    password: hunter2
+  secrets:
+    - source: ssh_key
+    - source: netrc
+      target: /root/.netrc
+  commands:
+    - go test
+
+deploy:
+  heroku:
+    app: foo.com
+    options:
+      force: true
+    when:
+      branch: master
+      expr: event == 'push'
+`
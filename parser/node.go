@@ -1,6 +1,12 @@
 package parser
 
-import "github.com/drone/drone-exec/yaml"
+import (
+	"fmt"
+	"path"
+
+	"github.com/drone/drone-exec/parser/expr"
+	"github.com/drone/drone-exec/yaml"
+)
 
 // NodeType identifies the type of a parse tree node.
 type NodeType uint
@@ -24,6 +30,26 @@ const (
 	NodePublish
 )
 
+var nodeNames = map[NodeType]string{
+	NodeList:    "list",
+	NodeFilter:  "filter",
+	NodeBuild:   "build",
+	NodeCache:   "cache",
+	NodeClone:   "clone",
+	NodeDeploy:  "deploy",
+	NodeCompose: "compose",
+	NodeNotify:  "notify",
+	NodePublish: "publish",
+}
+
+// String returns the name of the node type.
+func (t NodeType) String() string {
+	if name, ok := nodeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("NodeType(%d)", uint(t))
+}
+
 // Nodes.
 
 type Node interface {
@@ -50,6 +76,7 @@ func newListNode() *ListNode {
 type DockerNode struct {
 	NodeType
 
+	Name        string
 	Image       string
 	Pull        bool
 	Privileged  bool
@@ -57,16 +84,24 @@ type DockerNode struct {
 	Entrypoint  []string
 	Command     []string
 	Commands    []string
+	Shell       []string
 	Volumes     []string
 	ExtraHosts  []string
 	Net         string
 	AuthConfig  yaml.AuthConfig
+	Secrets     []*SecretFile
 	Vargs       map[string]interface{}
+
+	// Mandatory is true if the step is defined by the
+	// system base configuration. Mandatory steps are
+	// trusted and cannot be removed by the repository.
+	Mandatory bool
 }
 
 func newDockerNode(typ NodeType, c yaml.Container) *DockerNode {
 	return &DockerNode{
 		NodeType:    typ,
+		Name:        c.Name,
 		Image:       c.Image,
 		Pull:        c.Pull,
 		Privileged:  c.Privileged,
@@ -77,7 +112,42 @@ func newDockerNode(typ NodeType, c yaml.Container) *DockerNode {
 		ExtraHosts:  c.ExtraHosts,
 		Net:         c.Net,
 		AuthConfig:  c.AuthConfig,
+		Secrets:     newSecretFiles(c.Secrets),
+	}
+}
+
+// DefaultSecretDir is the directory of secret files
+// declared without a target.
+const DefaultSecretDir = "/run/secrets"
+
+// SecretFile represents a secret mounted as a file into
+// the container. The Value is resolved before the build
+// runs, and is never serialized.
+type SecretFile struct {
+	Source string
+	Target string
+	Value  string
+}
+
+func newSecretFiles(files []yaml.SecretFile) []*SecretFile {
+	var out []*SecretFile
+	for _, file := range files {
+		target := file.Target
+		if len(target) == 0 {
+			target = path.Join(DefaultSecretDir, file.Source)
+		}
+		out = append(out, &SecretFile{Source: file.Source, Target: target})
 	}
+	return out
+}
+
+// String returns the name of the step, for example
+// deploy/heroku, used when logging.
+func (d *DockerNode) String() string {
+	if len(d.Name) == 0 {
+		return d.NodeType.String()
+	}
+	return d.NodeType.String() + "/" + d.Name
 }
 
 func newPluginNode(typ NodeType, p yaml.Plugin) *DockerNode {
@@ -89,6 +159,7 @@ func newPluginNode(typ NodeType, p yaml.Plugin) *DockerNode {
 func newBuildNode(typ NodeType, b yaml.Build) *DockerNode {
 	node := newDockerNode(typ, b.Container)
 	node.Commands = b.Commands
+	node.Shell = b.Shell.Slice()
 	return node
 }
 
@@ -100,24 +171,78 @@ type FilterNode struct {
 
 	Repo    string
 	Branch  []string
+	Tag     []string
 	Event   []string
 	Success string
 	Failure string
 	Change  string
 	Matrix  map[string]string
+	Expr    *expr.Expr
 
 	Node Node // Node to execution if conditions met
+
+	patterns map[string]*Pattern // compiled patterns
 }
 
-func newFilterNode(p yaml.Plugin) *FilterNode {
-	return &FilterNode{
+func newFilterNode(f yaml.Filter) (*FilterNode, error) {
+	node := &FilterNode{
 		NodeType: NodeFilter,
-		Repo:     p.Filter.Repo,
-		Branch:   p.Filter.Branch.Slice(),
-		Event:    p.Filter.Event.Slice(),
-		Matrix:   p.Filter.Matrix,
-		Success:  p.Filter.Success,
-		Failure:  p.Filter.Failure,
-		Change:   p.Filter.Change,
+		Repo:     f.Repo,
+		Branch:   f.Branch.Slice(),
+		Tag:      f.Tag.Slice(),
+		Event:    f.Event.Slice(),
+		Matrix:   f.Matrix,
+		Success:  f.Success,
+		Failure:  f.Failure,
+		Change:   f.Change,
+	}
+	err := node.compile()
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Expr) != 0 {
+		node.Expr, err = expr.Parse(f.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing when expression %q. %s", f.Expr, err)
+		}
+	}
+	return node, nil
+}
+
+// compile parses the patterns of the filter once, so they
+// are not compiled each time the filter is evaluated. It
+// returns an error if a pattern is an invalid regular
+// expression.
+func (n *FilterNode) compile() error {
+	patterns := []string{n.Repo}
+	patterns = append(patterns, n.Branch...)
+	patterns = append(patterns, n.Tag...)
+	patterns = append(patterns, n.Event...)
+	for _, v := range n.Matrix {
+		patterns = append(patterns, v)
+	}
+	n.patterns = map[string]*Pattern{}
+	for _, raw := range patterns {
+		pattern, err := ParsePattern(raw)
+		if err != nil {
+			return err
+		}
+		n.patterns[raw] = pattern
+	}
+	return nil
+}
+
+// Match returns true if the string matches the pattern of
+// the filter. Patterns that were not compiled with the filter
+// are parsed on demand, and invalid patterns never match.
+func (n *FilterNode) Match(pattern, str string) bool {
+	p, ok := n.patterns[pattern]
+	if !ok {
+		var err error
+		p, err = ParsePattern(pattern)
+		if err != nil {
+			return false
+		}
 	}
+	return p.Match(str)
 }
@@ -19,19 +19,33 @@ func newTree(rules []RuleFunc) *Tree {
 
 // Parse parses the Yaml build definition file
 // and returns an execution Tree.
-func Parse(raw string, rules []RuleFunc) (*Tree, error) {
+func Parse(raw string, rules []RuleFunc, treeRules ...TreeRuleFunc) (*Tree, error) {
 	conf, err := yaml.ParseString(raw)
 	if err != nil {
 		return nil, err
 	}
-	return Load(conf, rules)
+	return Load(conf, rules, treeRules...)
 }
 
 // Load loads the Yaml build definition structure
-// and returns an execution Tree.
-func Load(conf *yaml.Config, rules []RuleFunc) (*Tree, error) {
+// and returns an execution Tree. The rules are applied
+// to each step as it is appended, first to the Docker node
+// and then to the filter node wrapping it. The tree rules
+// are applied once the tree is constructed.
+func Load(conf *yaml.Config, rules []RuleFunc, treeRules ...TreeRuleFunc) (*Tree, error) {
+	return LoadBase(conf, nil, rules, treeRules...)
+}
+
+// LoadBase loads the Yaml build definition structure,
+// merged with the mandatory steps of the base configuration,
+// and returns an execution Tree. The mandatory steps are
+// prepended and appended to the steps of each phase.
+func LoadBase(conf *yaml.Config, base *yaml.Base, rules []RuleFunc, treeRules ...TreeRuleFunc) (*Tree, error) {
 	var tree = newTree(rules)
 	var err error
+	if base == nil {
+		base = &yaml.Base{}
+	}
 
 	// Cache.
 	err = tree.appendCache(conf.Cache)
@@ -46,74 +60,132 @@ func Load(conf *yaml.Config, rules []RuleFunc) (*Tree, error) {
 	}
 
 	// Compose.
+	err = tree.appendMandatoryCompose(base.Prepend.Compose.Slice())
+	if err != nil {
+		return nil, err
+	}
 	err = tree.appendCompose(conf.Compose.Slice())
 	if err != nil {
 		return nil, err
 	}
+	err = tree.appendMandatoryCompose(base.Append.Compose.Slice())
+	if err != nil {
+		return nil, err
+	}
 
 	// Build
+	err = tree.appendMandatoryBuild(base.Prepend.Build.Slice())
+	if err != nil {
+		return nil, err
+	}
 	err = tree.appendBuild(conf.Build)
 	if err != nil {
 		return nil, err
 	}
+	err = tree.appendMandatoryBuild(base.Append.Build.Slice())
+	if err != nil {
+		return nil, err
+	}
 
 	// Publish.
-	err = tree.appendPlugin(NodePublish, conf.Publish.Slice()...)
+	err = tree.appendPhase(NodePublish, base.Prepend.Publish, conf.Publish, base.Append.Publish)
 	if err != nil {
 		return nil, err
 	}
 
 	// Deploy.
-	err = tree.appendPlugin(NodeDeploy, conf.Deploy.Slice()...)
+	err = tree.appendPhase(NodeDeploy, base.Prepend.Deploy, conf.Deploy, base.Append.Deploy)
 	if err != nil {
 		return nil, err
 	}
 
 	// Plugin.
-	err = tree.appendPlugin(NodeNotify, conf.Notify.Slice()...)
+	err = tree.appendPhase(NodeNotify, base.Prepend.Notify, conf.Notify, base.Append.Notify)
 	if err != nil {
 		return nil, err
 	}
 
+	for _, rule := range treeRules {
+		err = rule(tree)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return tree, nil
 }
 
 func (t *Tree) appendPlugin(typ NodeType, plugins ...yaml.Plugin) error {
 	for _, plugin := range plugins {
 		node := newPluginNode(typ, plugin)
-		for _, rule := range t.rules {
-			err := rule(node)
-			if err != nil {
-				return err
-			}
+		err := t.appendFilter(node, plugin.Filter)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendPhase appends the plugins of a phase, surrounded
+// by the mandatory plugins of the base configuration.
+func (t *Tree) appendPhase(typ NodeType, before, plugins, after yaml.Pluginslice) error {
+	err := t.appendMandatory(typ, before.Slice()...)
+	if err != nil {
+		return err
+	}
+	err = t.appendPlugin(typ, plugins.Slice()...)
+	if err != nil {
+		return err
+	}
+	return t.appendMandatory(typ, after.Slice()...)
+}
+
+// appendMandatory appends the mandatory plugins of the
+// base configuration.
+func (t *Tree) appendMandatory(typ NodeType, plugins ...yaml.Plugin) error {
+	for _, plugin := range plugins {
+		node := newPluginNode(typ, plugin)
+		node.Mandatory = true
+		err := t.appendFilter(node, plugin.Filter)
+		if err != nil {
+			return err
 		}
-		fnode := newFilterNode(plugin)
-		fnode.Node = node
-		// TODO: we should apply rules to all nodes in
-		// the tree AFTER the entire tree is constructed.
-		for _, rule := range t.rules {
-			err := rule(fnode)
-			if err != nil {
-				return err
-			}
+	}
+	return nil
+}
+
+// appendMandatoryCompose appends the mandatory compose
+// steps of the base configuration.
+func (t *Tree) appendMandatoryCompose(containers []yaml.Container) error {
+	for _, container := range containers {
+		node := newDockerNode(NodeCompose, container)
+		node.Mandatory = true
+		err := t.appendFilter(node, container.Filter)
+		if err != nil {
+			return err
 		}
-		t.Root.append(fnode)
 	}
 	return nil
 }
 
-func (t *Tree) appendBuild(build yaml.Build) error {
-	node := newBuildNode(NodeBuild, build)
-	for _, rule := range t.rules {
-		err := rule(node)
+// appendMandatoryBuild appends the mandatory build steps
+// of the base configuration.
+func (t *Tree) appendMandatoryBuild(builds []yaml.Build) error {
+	for _, build := range builds {
+		node := newBuildNode(NodeBuild, build)
+		node.Mandatory = true
+		err := t.appendFilter(node, build.Filter)
 		if err != nil {
 			return err
 		}
 	}
-	t.Root.append(node)
 	return nil
 }
 
+func (t *Tree) appendBuild(build yaml.Build) error {
+	node := newBuildNode(NodeBuild, build)
+	return t.appendFilter(node, build.Filter)
+}
+
 func (t *Tree) appendCache(cache yaml.Plugin) error {
 	if len(cache.Vargs) == 0 {
 		return nil
@@ -124,13 +196,41 @@ func (t *Tree) appendCache(cache yaml.Plugin) error {
 func (t *Tree) appendCompose(plugins []yaml.Container) error {
 	for _, plugin := range plugins {
 		node := newDockerNode(NodeCompose, plugin)
-		for _, rule := range t.rules {
-			err := rule(node)
-			if err != nil {
-				return err
-			}
+		err := t.appendFilter(node, plugin.Filter)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendFilter wraps the node in a filter node, built
+// from the `when` section of the step, applies the rules
+// to both nodes and appends it to the tree.
+func (t *Tree) appendFilter(node *DockerNode, filter yaml.Filter) error {
+	err := t.applyRules(node)
+	if err != nil {
+		return err
+	}
+	fnode, err := newFilterNode(filter)
+	if err != nil {
+		return err
+	}
+	fnode.Node = node
+	err = t.applyRules(fnode)
+	if err != nil {
+		return err
+	}
+	t.Root.append(fnode)
+	return nil
+}
+
+func (t *Tree) applyRules(node Node) error {
+	for _, rule := range t.rules {
+		err := rule(node)
+		if err != nil {
+			return err
 		}
-		t.Root.append(node)
 	}
 	return nil
 }
@@ -1 +1,177 @@
 package parser
+
+import (
+	"testing"
+
+	"github.com/drone/drone-exec/yaml"
+	"github.com/franela/goblin"
+)
+
+func TestParse(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Parse tree", func() {
+
+		g.It("Should wrap build and compose nodes in filters", func() {
+			tree, err := Parse(filterYaml, nil)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(tree.Root.Nodes)).Equal(3)
+
+			compose := tree.Root.Nodes[1].(*FilterNode)
+			g.Assert(compose.Branch).Equal([]string{"master"})
+			g.Assert(compose.Node.Type()).Equal(NodeCompose)
+
+			build := tree.Root.Nodes[2].(*FilterNode)
+			g.Assert(build.Matrix).Equal(map[string]string{"GO_VERSION": "1.5"})
+			g.Assert(build.Node.Type()).Equal(NodeBuild)
+		})
+
+		g.It("Should walk the tree in execution order", func() {
+			tree, _ := Parse(filterYaml, nil)
+			var types []NodeType
+			Walk(tree.Root, func(n Node) error {
+				types = append(types, n.Type())
+				return nil
+			})
+			g.Assert(types).Equal([]NodeType{
+				NodeList,
+				NodeFilter, NodeClone,
+				NodeFilter, NodeCompose,
+				NodeFilter, NodeBuild,
+			})
+		})
+
+		g.It("Should let tree rules inject nodes", func() {
+			inject := func(t *Tree) error {
+				t.Root.Nodes = append(t.Root.Nodes, &DockerNode{
+					NodeType: NodeNotify,
+					Image:    "plugins/drone-slack",
+				})
+				return nil
+			}
+			tree, err := Parse(filterYaml, nil, inject)
+			g.Assert(err == nil).IsTrue()
+			steps := tree.Steps()
+			g.Assert(steps[len(steps)-1].Image).Equal("plugins/drone-slack")
+		})
+
+		g.It("Should apply rules to each step before its filter", func() {
+			var types []NodeType
+			rule := func(n Node) error {
+				types = append(types, n.Type())
+				return nil
+			}
+			_, err := Parse(filterYaml, []RuleFunc{rule})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(types).Equal([]NodeType{
+				NodeClone, NodeFilter,
+				NodeCompose, NodeFilter,
+				NodeBuild, NodeFilter,
+			})
+		})
+
+		g.It("Should reject invalid when patterns", func() {
+			_, err := Parse(patternYaml, nil)
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("Should compile when patterns with the filter", func() {
+			tree, _ := Parse(filterYaml, nil)
+			build := tree.Root.Nodes[2].(*FilterNode)
+			g.Assert(len(build.patterns)).Equal(2)
+			g.Assert(build.Match("1.*", "1.5")).IsTrue()
+			g.Assert(build.Match("regex:1\\.[0-9]", "1.5")).IsTrue()
+			g.Assert(build.Match("!regex:1\\.[0-9]", "1.5")).IsFalse()
+			g.Assert(build.Match("regex:v[0-9", "v1")).IsFalse()
+		})
+
+		g.It("Should reject invalid when expressions", func() {
+			_, err := Parse(exprYaml, nil)
+			g.Assert(err.Error()).Equal(`Error parsing when expression "branch = 'master'". unexpected character '=' at column 8`)
+		})
+
+		g.It("Should merge mandatory steps of the base config", func() {
+			conf, _ := yaml.ParseString(baseRepoYaml)
+			base, err := yaml.ParseBaseString(baseYaml)
+			g.Assert(err == nil).IsTrue()
+
+			tree, err := LoadBase(conf, base, []RuleFunc{Sanitize})
+			g.Assert(err == nil).IsTrue()
+
+			var names []string
+			for _, step := range tree.Steps() {
+				names = append(names, step.String())
+			}
+			g.Assert(names).Equal([]string{
+				"clone",
+				"build/license",
+				"build",
+				"publish/docker",
+				"publish/sbom",
+			})
+
+			steps := tree.Steps()
+			g.Assert(steps[1].Mandatory).IsTrue()
+			g.Assert(steps[1].Privileged).IsTrue()
+			g.Assert(steps[2].Mandatory).IsFalse()
+			g.Assert(steps[2].Privileged).IsFalse()
+			g.Assert(steps[4].Mandatory).IsTrue()
+		})
+	})
+}
+
+var filterYaml = `
+build:
+  image: golang
+  commands:
+    - go test
+  when:
+    matrix:
+      GO_VERSION: 1.5
+
+compose:
+  selenium:
+    image: selenium/standalone-firefox
+    when:
+      branch: master
+`
+
+var exprYaml = `
+deploy:
+  heroku:
+    when:
+      expr: branch = 'master'
+`
+
+var patternYaml = `
+deploy:
+  heroku:
+    when:
+      tag: regex:v[0-9
+`
+
+var baseRepoYaml = `
+build:
+  image: golang
+  privileged: true
+  commands:
+    - go test
+
+publish:
+  docker:
+    repo: foo/bar
+`
+
+var baseYaml = `
+prepend:
+  build:
+    license:
+      image: license/scan
+      privileged: true
+      commands:
+        - scan
+append:
+  publish:
+    sbom:
+      image: plugins/sbom
+`
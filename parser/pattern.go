@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Pattern matches a string against a glob pattern, or a
+// regular expression when the pattern uses the regex:
+// prefix. The regular expression must match the entire
+// string. Patterns prefixed with ! are negated.
+type Pattern struct {
+	raw    string
+	glob   string
+	re     *regexp.Regexp
+	negate bool
+}
+
+// ParsePattern parses a when filter pattern. It returns an
+// error if the pattern is an invalid regular expression.
+func ParsePattern(raw string) (*Pattern, error) {
+	p := &Pattern{raw: raw, glob: raw}
+	if strings.HasPrefix(p.glob, "!") {
+		p.negate = true
+		p.glob = p.glob[1:]
+	}
+	if strings.HasPrefix(p.glob, "regex:") {
+		re, err := regexp.Compile("^(?:" + p.glob[6:] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing when pattern %q. %s", raw, err)
+		}
+		p.re = re
+	}
+	return p, nil
+}
+
+// Match returns true if the string matches the pattern.
+func (p *Pattern) Match(str string) bool {
+	var match bool
+	if p.re != nil {
+		match = p.re.MatchString(str)
+	} else {
+		match, _ = path.Match(p.glob, str)
+	}
+	return match != p.negate
+}
+
+func (p *Pattern) String() string {
+	return p.raw
+}
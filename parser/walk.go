@@ -0,0 +1,45 @@
+package parser
+
+// WalkFunc is the type of the function called for each
+// node visited by Walk. If the function returns an error
+// the walk is stopped and the error is returned.
+type WalkFunc func(Node) error
+
+// Walk traverses the tree in depth-first order, calling
+// fn for each node before visiting its children. The
+// children are read after fn returns, so fn may modify
+// or replace them.
+func Walk(n Node, fn WalkFunc) error {
+	if n == nil {
+		return nil
+	}
+	err := fn(n)
+	if err != nil {
+		return err
+	}
+	switch n := n.(type) {
+	case *ListNode:
+		for _, child := range n.Nodes {
+			err = Walk(child, fn)
+			if err != nil {
+				return err
+			}
+		}
+	case *FilterNode:
+		return Walk(n.Node, fn)
+	}
+	return nil
+}
+
+// Steps returns the Docker nodes in the tree in
+// execution order.
+func (t *Tree) Steps() []*DockerNode {
+	var steps []*DockerNode
+	Walk(t.Root, func(n Node) error {
+		if d, ok := n.(*DockerNode); ok {
+			steps = append(steps, d)
+		}
+		return nil
+	})
+	return steps
+}
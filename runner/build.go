@@ -2,8 +2,9 @@ package runner
 
 import (
 	"errors"
+	"fmt"
 
-	// log "github.com/Sirupsen/logrus"
+	log "github.com/Sirupsen/logrus"
 	"github.com/drone/drone-exec/docker"
 	"github.com/drone/drone-exec/parser"
 	"github.com/drone/drone-exec/runner/script"
@@ -44,9 +45,19 @@ func (b *Build) walk(node parser.Node, state *State) (err error) {
 		}
 
 	case *parser.FilterNode:
-		if isMatch(node, state) {
-			b.walk(node.Node, state)
+		// filters are only evaluated for the steps being
+		// executed, since the build status may still change
+		// before the remaining steps run.
+		if child, ok := node.Node.(*parser.DockerNode); ok && shouldSkip(b.flags, child.NodeType) {
+			break
+		}
+		if skip := matchFilter(node, state); skip != nil {
+			skip.Step = fmt.Sprint(node.Node)
+			log.Infof("skipping %s: %s", skip.Step, skip)
+			state.Skip(skip)
+			break
 		}
+		b.walk(node.Node, state)
 
 	case *parser.DockerNode:
 		if shouldSkip(b.flags, node.NodeType) {
@@ -98,7 +109,7 @@ func (b *Build) walk(node parser.Node, state *State) (err error) {
 				script.Encode(nil, conf, node)
 			}
 
-			info, err := docker.Run(state.Client, conf, auth, node.Pull, state.Stdout, state.Stderr)
+			info, err := docker.RunFiles(state.Client, conf, auth, node.Pull, toFiles(node), state.Stdout, state.Stderr)
 			if err != nil {
 				state.Exit(255)
 			} else if info.State.ExitCode != 0 {
@@ -107,7 +118,7 @@ func (b *Build) walk(node parser.Node, state *State) (err error) {
 
 		case parser.NodeCompose:
 			conf := toContainerConfig(node)
-			_, err := docker.Start(state.Client, conf, auth, node.Pull)
+			_, err := docker.StartFiles(state.Client, conf, auth, node.Pull, toFiles(node))
 			if err != nil {
 				state.Exit(255)
 			}
@@ -115,7 +126,7 @@ func (b *Build) walk(node parser.Node, state *State) (err error) {
 		default:
 			conf := toContainerConfig(node)
 			conf.Cmd = toCommand(state, node)
-			info, err := docker.Run(state.Client, conf, auth, node.Pull, state.Stdout, state.Stderr)
+			info, err := docker.RunFiles(state.Client, conf, auth, node.Pull, toFiles(node), state.Stdout, state.Stderr)
 			if err != nil {
 				state.Exit(255)
 			} else if info.State.ExitCode != 0 {
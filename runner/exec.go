@@ -24,6 +24,10 @@ type State struct {
 	Client dockerclient.Client
 
 	Stdout, Stderr io.Writer
+
+	// Skipped lists the steps that were skipped because
+	// their conditions did not match.
+	Skipped []*Skip
 }
 
 // Exit writes the exit code. A non-zero value
@@ -53,3 +57,11 @@ func (s *State) ExitCode() int {
 func (s *State) Failed() bool {
 	return s.ExitCode() != 0
 }
+
+// Skip records a step that was skipped.
+func (s *State) Skip(skip *Skip) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.Skipped = append(s.Skipped, skip)
+}
@@ -2,63 +2,95 @@ package runner
 
 import (
 	"fmt"
-	"path"
+	"sort"
 	"strings"
 
 	"github.com/drone/drone-exec/parser"
 	"github.com/drone/drone-plugin-go/plugin"
 )
 
+// Skip describes why a step was skipped. It records the
+// criterion that failed with the expected and actual values.
+type Skip struct {
+	Step  string `json:"step"`
+	Field string `json:"field"`
+	Want  string `json:"want"`
+	Got   string `json:"got"`
+}
+
+func (s *Skip) String() string {
+	switch s.Field {
+	case "expr":
+		return fmt.Sprintf("expression %s is false", s.Want)
+	case "status":
+		return fmt.Sprintf("status %q does not match %s", s.Got, s.Want)
+	}
+	return fmt.Sprintf("%s %q does not match %s", s.Field, s.Got, s.Want)
+}
+
 // isMatch is a helper function that returns true if
 // all criteria is matched.
-func isMatch(node *parser.FilterNode, s *State) (match bool) {
+func isMatch(node *parser.FilterNode, s *State) bool {
+	return matchFilter(node, s) == nil
+}
+
+// matchFilter is a helper function that returns nil if
+// all criteria is matched. Otherwise it returns the first
+// criterion that failed.
+func matchFilter(node *parser.FilterNode, s *State) *Skip {
 
 	var last string
 	if s.BuildLast != nil {
 		last = s.BuildLast.Status
 	}
 
-	switch {
-	case !matchBranch(node.Branch, s.Build.Branch):
-		return false
-	case !matchMatrix(node.Matrix, s.Job.Environment):
-		return false
-	case !matchRepo(node.Repo, s.Repo.FullName):
-		return false
-	case !matchEvent(node.Event, s.Build.Event):
-		return false
+	if !matchBranch(node.Match, node.Branch, s.Build.Branch) {
+		return &Skip{Field: "branch", Want: fmt.Sprint(node.Branch), Got: strings.TrimPrefix(s.Build.Branch, "refs/heads/")}
+	}
+	if !matchTag(node.Match, node.Tag, s.Build.Ref) {
+		return &Skip{Field: "ref", Want: fmt.Sprintf("tag %v", node.Tag), Got: s.Build.Ref}
+	}
+	if k := matchMatrix(node.Match, node.Matrix, s.Job.Environment); len(k) != 0 {
+		return &Skip{Field: "matrix." + k, Want: fmt.Sprintf("%q", node.Matrix[k]), Got: s.Job.Environment[k]}
+	}
+	if !matchRepo(node.Match, node.Repo, s.Repo.FullName) {
+		return &Skip{Field: "repo", Want: fmt.Sprintf("%q", node.Repo), Got: s.Repo.FullName}
+	}
+	if !matchEvent(node.Match, node.Event, s.Build.Event) {
+		return &Skip{Field: "event", Want: fmt.Sprint(node.Event), Got: s.Build.Event}
+	}
+	if node.Expr != nil && !node.Expr.Eval(exprVars(s, last)) {
+		return &Skip{Field: "expr", Want: fmt.Sprintf("%q", node.Expr), Got: "false"}
 	}
 
 	switch {
 	case matchSuccess(node.Success, s.Job.Status):
-		return true
+		return nil
 	case matchFailure(node.Failure, s.Job.Status):
-		return true
+		return nil
 	case matchChange(node.Change, s.Job.Status, last):
-		return true
+		return nil
 	}
 
-	return false
+	return &Skip{
+		Field: "status",
+		Want:  fmt.Sprintf("[success: %s, failure: %s, change: %s]", node.Success, node.Failure, node.Change),
+		Got:   s.Job.Status,
+	}
 }
 
 // matchBranch is a helper function that returns true
 // if all_branches is true. Else it returns false if a
 // branch condition is specified, and the branch does
 // not match.
-func matchBranch(want []string, got string) (match bool) {
+func matchBranch(match matcher, want []string, got string) bool {
 	if len(want) == 0 {
 		return true
 	}
 	if strings.HasPrefix(got, "refs/heads/") {
 		got = got[11:]
 	}
-	for _, pattern := range want {
-		if matchPath(pattern, got) {
-			match = true
-			break
-		}
-	}
-	return
+	return matchAny(match, want, got)
 }
 
 // matchRepo is a helper function that returns false
@@ -67,42 +99,74 @@ func matchBranch(want []string, got string) (match bool) {
 //
 // This is useful when you want to prevent forks from
 // executing deployment, publish or notification steps.
-func matchRepo(want, got string) bool {
+func matchRepo(match matcher, want, got string) bool {
 	if len(want) == 0 {
 		return true
 	}
-	return got == want
+	return match(want, got)
+}
+
+// matchTag is a helper function that returns false if
+// a tag condition is specified, and the build is not
+// for a matching tag.
+func matchTag(match matcher, want []string, ref string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	if !strings.HasPrefix(ref, "refs/tags/") {
+		return false
+	}
+	return matchAny(match, want, ref[10:])
 }
 
 // matchEvent is a helper function that returns false
 // if this task is only intended for a specific repository
 // event not matched by the current build. For example,
 // only executing a build for `tags` or `pull_requests`
-func matchEvent(want []string, got string) (match bool) {
+func matchEvent(match matcher, want []string, got string) bool {
 	if len(want) == 0 {
 		return true
 	}
-	for _, want_ := range want {
-		if got == want_ {
-			match = true
-			break
+	return matchAny(match, want, got)
+}
+
+// matchMatrix is a helper function that limits steps to
+// only certain matrix axis. It returns the name of the first
+// parameter that does not match, or an empty string.
+func matchMatrix(match matcher, want, got map[string]string) string {
+	var keys []string
+	for k := range want {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !match(want[k], got[k]) {
+			return k
 		}
 	}
-	return
+	return ""
 }
 
-// matchMatrix is a helper function that returns false
-// to limit steps to only certain matrix axis.
-func matchMatrix(want, got map[string]string) bool {
-	if len(want) == 0 {
-		return true
+// exprVars is a helper function that returns the
+// variables available to a when expression.
+func exprVars(s *State, last string) map[string]string {
+	status := s.Job.Status
+	if status == plugin.StateRunning {
+		status = plugin.StateSuccess
 	}
-	for k, v := range want {
-		if got[k] != v {
-			return false
-		}
+	vars := map[string]string{
+		"repo":     s.Repo.FullName,
+		"branch":   strings.TrimPrefix(s.Build.Branch, "refs/heads/"),
+		"event":    s.Build.Event,
+		"status":   status,
+		"previous": last,
+		"ref":      s.Build.Ref,
+		"commit":   s.Build.Commit,
 	}
-	return true
+	for k, v := range s.Job.Environment {
+		vars["matrix."+k] = v
+	}
+	return vars
 }
 
 func matchSuccess(toggle, status string) bool {
@@ -143,14 +207,17 @@ func parseBool(str string) (value bool, err error) {
 	return false, fmt.Errorf("Error parsing boolean %s", str)
 }
 
-func matchPath(pattern, str string) bool {
-	negate := strings.HasPrefix(pattern, "!")
-	if negate {
-		pattern = pattern[1:]
-	}
-	match, _ := path.Match(pattern, str)
-	if negate {
-		match = !match
+// matcher matches a string against a when filter pattern.
+// See parser.Pattern for the pattern syntax.
+type matcher func(pattern, str string) bool
+
+// matchAny is a helper function that returns true if
+// the string matches any of the patterns.
+func matchAny(match matcher, patterns []string, str string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, str) {
+			return true
+		}
 	}
-	return match
+	return false
 }
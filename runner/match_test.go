@@ -3,6 +3,9 @@ package runner
 import (
 	"testing"
 
+	"github.com/drone/drone-exec/parser"
+	"github.com/drone/drone-exec/parser/expr"
+	"github.com/drone/drone-plugin-go/plugin"
 	"github.com/franela/goblin"
 )
 
@@ -11,32 +14,34 @@ func TestParse(t *testing.T) {
 	g := goblin.Goblin(t)
 	g.Describe("Yaml conditions", func() {
 
+		match := new(parser.FilterNode).Match
+
 		g.It("Should match a branch", func() {
-			g.Assert(matchBranch([]string{"master"}, "master")).Equal(true)
+			g.Assert(matchBranch(match, []string{"master"}, "master")).Equal(true)
 		})
 
 		g.It("Should match a branch wildcard", func() {
-			g.Assert(matchBranch([]string{"*"}, "master")).Equal(true)
+			g.Assert(matchBranch(match, []string{"*"}, "master")).Equal(true)
 		})
 
 		g.It("Should match a branch with negation", func() {
-			g.Assert(matchBranch([]string{"!dev"}, "master")).Equal(true)
+			g.Assert(matchBranch(match, []string{"!dev"}, "master")).Equal(true)
 		})
 
 		g.It("Should match when branch slice is empty", func() {
-			g.Assert(matchBranch([]string{}, "master")).Equal(true)
+			g.Assert(matchBranch(match, []string{}, "master")).Equal(true)
 		})
 
 		g.It("Should match when branch matches one of", func() {
-			g.Assert(matchBranch([]string{"dev", "master"}, "master")).Equal(true)
+			g.Assert(matchBranch(match, []string{"dev", "master"}, "master")).Equal(true)
 		})
 
 		g.It("Should not match a branch", func() {
-			g.Assert(matchBranch([]string{"dev"}, "master")).Equal(false)
+			g.Assert(matchBranch(match, []string{"dev"}, "master")).Equal(false)
 		})
 
 		g.It("Should not match a branch with negation", func() {
-			g.Assert(matchBranch([]string{"!master"}, "master")).Equal(false)
+			g.Assert(matchBranch(match, []string{"!master"}, "master")).Equal(false)
 		})
 
 		g.It("Should notify on change", func() {
@@ -58,11 +63,91 @@ func TestParse(t *testing.T) {
 		})
 
 		g.It("Should not match an event", func() {
-			g.Assert(matchBranch([]string{"production"}, "deployment")).Equal(false)
+			g.Assert(matchBranch(match, []string{"production"}, "deployment")).Equal(false)
 		})
 
 		g.It("Should match an event", func() {
-			g.Assert(matchBranch([]string{"deployment"}, "deployment")).Equal(true)
+			g.Assert(matchBranch(match, []string{"deployment"}, "deployment")).Equal(true)
+		})
+
+		g.It("Should match a branch regular expression", func() {
+			g.Assert(matchBranch(match, []string{"regex:release/[0-9]+"}, "release/12")).Equal(true)
+			g.Assert(matchBranch(match, []string{"regex:release/[0-9]+"}, "release/12-rc")).Equal(false)
+			g.Assert(matchBranch(match, []string{"!regex:feature/.*"}, "master")).Equal(true)
+		})
+
+		g.It("Should match a tag", func() {
+			want := []string{`regex:v[0-9]+\.[0-9]+\.[0-9]+`}
+			g.Assert(matchTag(match, want, "refs/tags/v1.2.3")).Equal(true)
+			g.Assert(matchTag(match, want, "refs/tags/v1.2.3-beta")).Equal(false)
+			g.Assert(matchTag(match, []string{"v*"}, "refs/tags/v1.2.3")).Equal(true)
+		})
+
+		g.It("Should not match a tag for other refs", func() {
+			g.Assert(matchTag(match, []string{"*"}, "refs/heads/master")).Equal(false)
+			g.Assert(matchTag(match, []string{}, "refs/heads/master")).Equal(true)
+		})
+
+		g.It("Should match a repo pattern", func() {
+			g.Assert(matchRepo(match, "octocat/*", "octocat/hello-world")).Equal(true)
+			g.Assert(matchRepo(match, "!octocat/*", "octocat/hello-world")).Equal(false)
+			g.Assert(matchRepo(match, "octocat/hello-world", "octocat/hello-world")).Equal(true)
+			g.Assert(matchRepo(match, "octocat/hello-world", "drone/hello-world")).Equal(false)
+		})
+
+		g.It("Should match a matrix pattern", func() {
+			got := map[string]string{"GO_VERSION": "1.5", "DB": "mysql"}
+			g.Assert(matchMatrix(match, map[string]string{"GO_VERSION": "1.*"}, got)).Equal("")
+			g.Assert(matchMatrix(match, map[string]string{"GO_VERSION": "!1.4"}, got)).Equal("")
+			g.Assert(matchMatrix(match, map[string]string{"GO_VERSION": "1.*", "DB": "postgres"}, got)).Equal("DB")
+		})
+
+		g.It("Should match an event pattern", func() {
+			g.Assert(matchEvent(match, []string{"!pull_request"}, "push")).Equal(true)
+			g.Assert(matchEvent(match, []string{"!pull_request"}, "pull_request")).Equal(false)
+			g.Assert(matchEvent(match, []string{"push", "tag"}, "tag")).Equal(true)
+		})
+
+		g.It("Should match a when expression", func() {
+			state := &State{
+				Repo:  &plugin.Repo{FullName: "octocat/hello-world"},
+				Build: &plugin.Build{Branch: "master", Event: plugin.EventPush},
+				Job: &plugin.Job{
+					Status:      plugin.StateRunning,
+					Environment: map[string]string{"GO_VERSION": "1.5"},
+				},
+			}
+			node := &parser.FilterNode{}
+			node.Expr, _ = expr.Parse("branch == 'master' && status == 'success' && matrix.GO_VERSION == '1.5'")
+			g.Assert(isMatch(node, state)).Equal(true)
+			node.Expr, _ = expr.Parse("event == 'tag' || repo != 'octocat/hello-world'")
+			g.Assert(isMatch(node, state)).Equal(false)
+		})
+
+		g.It("Should explain why a step was skipped", func() {
+			state := &State{
+				Repo:  &plugin.Repo{FullName: "octocat/hello-world"},
+				Build: &plugin.Build{Branch: "feature/x", Event: plugin.EventPush},
+				Job: &plugin.Job{
+					Status:      plugin.StateFailure,
+					Environment: map[string]string{"GO_VERSION": "1.4"},
+				},
+			}
+			node := &parser.FilterNode{Branch: []string{"master"}}
+			g.Assert(matchFilter(node, state).String()).Equal(`branch "feature/x" does not match [master]`)
+
+			node = &parser.FilterNode{Matrix: map[string]string{"GO_VERSION": "1.5"}}
+			g.Assert(matchFilter(node, state).String()).Equal(`matrix.GO_VERSION "1.4" does not match "1.5"`)
+
+			node = &parser.FilterNode{Event: []string{"tag"}}
+			g.Assert(matchFilter(node, state).String()).Equal(`event "push" does not match [tag]`)
+
+			node = &parser.FilterNode{Success: "true", Failure: "false", Change: "false"}
+			g.Assert(matchFilter(node, state).String()).Equal(`status "failure" does not match [success: true, failure: false, change: false]`)
+
+			node = &parser.FilterNode{}
+			node.Expr, _ = expr.Parse("branch == 'master'")
+			g.Assert(matchFilter(node, state).String()).Equal(`expression "branch == 'master'" is false`)
 		})
 	})
 
@@ -2,14 +2,14 @@ package script
 
 // entrypoint is the default bash entrypoint command
 // slice, used to execute a build script in string format.
-var entrypoint = []string{"/bin/sh", "-e", "-c"}
+var entrypoint = defaultShell.entrypoint()
 
 // setupScript is a helper script this is added
 // to the build to ensure a minimum set of environment
 // variables are set correctly.
 const setupScript = `
 [ -z "$HOME"  ] && export HOME="/root"
-[ -z "$SHELL" ] && export SHELL="/bin/sh"
+[ -z "$SHELL" ] && export SHELL=%s
 
 export GOBIN=/drone/bin
 export GOPATH=/drone
@@ -18,6 +18,12 @@ export PATH=$PATH:$GOBIN
 set -e
 `
 
+// pipefailScript is a helper script that is added to
+// the build script, for shells that support it, to fail
+// when any command of a pipeline fails.
+const pipefailScript = `set -o pipefail
+`
+
 const teardownScript = `
 rm -rf $HOME/.netrc
 rm -rf $HOME/.ssh/id_rsa
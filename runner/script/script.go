@@ -2,6 +2,7 @@ package script
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/drone/drone-exec/parser"
 	"github.com/drone/drone-plugin-go/plugin"
@@ -11,10 +12,16 @@ import (
 // Encode encodes the build script as a command in the
 // provided Container config. For linux, the build script
 // is embedded as the container entrypoint command, base64
-// encoded as a one-line script.
+// encoded as a one-line script. The script is executed by
+// the shell selected for the build step, or /bin/sh.
 func Encode(w *plugin.Workspace, c *dockerclient.ContainerConfig, n *parser.DockerNode) {
+	sh := lookupShell(n.Shell)
+
 	var buf bytes.Buffer
-	buf.WriteString(setupScript)
+	buf.WriteString(fmt.Sprintf(setupScript, quote(sh.cmd[0])))
+	if sh.pipefail {
+		buf.WriteString(pipefailScript)
+	}
 
 	if w != nil && w.Keys != nil && w.Netrc != nil {
 		buf.WriteString(writeKey(
@@ -30,6 +37,6 @@ func Encode(w *plugin.Workspace, c *dockerclient.ContainerConfig, n *parser.Dock
 	buf.WriteString(writeCmds(n.Commands))
 	buf.WriteString(teardownScript)
 
-	c.Entrypoint = entrypoint
-	c.Cmd = []string{encode(buf.Bytes())}
+	c.Entrypoint = sh.entrypoint()
+	c.Cmd = []string{encodeShell(buf.Bytes(), sh)}
 }
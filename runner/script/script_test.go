@@ -1,6 +1,8 @@
 package script
 
 import (
+	"encoding/base64"
+	"strings"
 	"testing"
 
 	"github.com/drone/drone-exec/parser"
@@ -49,12 +51,65 @@ func Test_Rule(t *testing.T) {
 			g.Assert(c.Entrypoint).Equal(entrypoint)
 			g.Assert(want).Equal(got)
 		})
+
+		g.It("Should encode the build script for bash", func() {
+			c := &dockerclient.ContainerConfig{}
+			n := &parser.DockerNode{
+				Commands: []string{"go build", "go test"},
+				Shell:    []string{"bash"},
+			}
+			Encode(nil, c, n)
+
+			g.Assert(c.Entrypoint).Equal([]string{"/bin/bash", "-e", "-c"})
+			g.Assert(c.Cmd[0]).Equal(encodeShell(decoded3, shells["bash"]))
+			g.Assert(strings.HasSuffix(c.Cmd[0], "| base64 -d | /bin/bash")).IsTrue()
+		})
+
+		g.It("Should encode the build script for a custom interpreter", func() {
+			c := &dockerclient.ContainerConfig{}
+			n := &parser.DockerNode{
+				Commands: []string{"go build"},
+				Shell:    []string{"/usr/local/bin/zsh", "-o", "extended glob"},
+			}
+			Encode(nil, c, n)
+
+			g.Assert(c.Entrypoint).Equal([]string{"/usr/local/bin/zsh", "-o", "extended glob", "-e", "-c"})
+			g.Assert(strings.HasSuffix(c.Cmd[0], "| base64 -d | /usr/local/bin/zsh -o 'extended glob'")).IsTrue()
+		})
+
+		g.It("Should quote the interpreter in the setup script", func() {
+			c := &dockerclient.ContainerConfig{}
+			n := &parser.DockerNode{
+				Commands: []string{"go build"},
+				Shell:    []string{`/opt/"my shell"/$sh`},
+			}
+			Encode(nil, c, n)
+
+			encoded := strings.Fields(c.Cmd[0])[1]
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			g.Assert(strings.Contains(string(decoded), `export SHELL='/opt/"my shell"/$sh'`)).IsTrue()
+		})
+
+		g.It("Should enable pipefail for supported shells", func() {
+			g.Assert(lookupShell(nil).pipefail).IsFalse()
+			g.Assert(lookupShell([]string{"sh"}).pipefail).IsFalse()
+			g.Assert(lookupShell([]string{"ash"}).pipefail).IsTrue()
+			g.Assert(lookupShell([]string{"/usr/bin/bash"}).pipefail).IsTrue()
+			g.Assert(lookupShell([]string{"/bin/dash"}).pipefail).IsFalse()
+			g.Assert(lookupShell([]string{"/usr/local/bin/zsh", "-o", "extended glob"}).pipefail).IsTrue()
+		})
+
+		g.It("Should quote interpreter arguments", func() {
+			g.Assert(quote("/bin/sh")).Equal("/bin/sh")
+			g.Assert(quote("")).Equal("''")
+			g.Assert(quote("it's")).Equal(`'it'\''s'`)
+		})
 	})
 }
 
 var decoded1 = []byte(`
 [ -z "$HOME"  ] && export HOME="/root"
-[ -z "$SHELL" ] && export SHELL="/bin/sh"
+[ -z "$SHELL" ] && export SHELL=/bin/sh
 
 export GOBIN=/drone/bin
 export GOPATH=/drone
@@ -74,7 +129,7 @@ rm -rf $HOME/.ssh/id_rsa
 
 var decoded2 = []byte(`
 [ -z "$HOME"  ] && export HOME="/root"
-[ -z "$SHELL" ] && export SHELL="/bin/sh"
+[ -z "$SHELL" ] && export SHELL=/bin/sh
 
 export GOBIN=/drone/bin
 export GOPATH=/drone
@@ -113,3 +168,24 @@ go test
 rm -rf $HOME/.netrc
 rm -rf $HOME/.ssh/id_rsa
 `)
+
+var decoded3 = []byte(`
+[ -z "$HOME"  ] && export HOME="/root"
+[ -z "$SHELL" ] && export SHELL=/bin/bash
+
+export GOBIN=/drone/bin
+export GOPATH=/drone
+export PATH=$PATH:$GOBIN
+
+set -e
+set -o pipefail
+
+echo JCBnbyBidWlsZAo= | base64 -d
+go build
+
+echo JCBnbyB0ZXN0Cg== | base64 -d
+go test
+
+rm -rf $HOME/.netrc
+rm -rf $HOME/.ssh/id_rsa
+`)
@@ -0,0 +1,76 @@
+package script
+
+import (
+	"path"
+	"strings"
+)
+
+// shell defines the interpreter of the build script.
+type shell struct {
+	cmd      []string // interpreter path and arguments
+	pipefail bool     // supports set -o pipefail
+}
+
+// shells defines the interpreters that can be selected
+// by name. Custom interpreters support set -o pipefail if
+// their base name is listed with pipefail.
+var shells = map[string]*shell{
+	"sh":   {cmd: []string{"/bin/sh"}},
+	"ash":  {cmd: []string{"/bin/ash"}, pipefail: true},
+	"bash": {cmd: []string{"/bin/bash"}, pipefail: true},
+	"ksh":  {cmd: []string{"/bin/ksh"}, pipefail: true},
+	"zsh":  {cmd: []string{"/bin/zsh"}, pipefail: true},
+}
+
+// defaultShell is the interpreter used when none is
+// selected.
+var defaultShell = shells["sh"]
+
+// lookupShell returns the interpreter for the shell option
+// of the build step, which is either the name of a known
+// shell or a custom interpreter path with arguments.
+func lookupShell(cmd []string) *shell {
+	if len(cmd) == 0 {
+		return defaultShell
+	}
+	if s, ok := shells[cmd[0]]; ok && len(cmd) == 1 {
+		return s
+	}
+	custom := &shell{cmd: cmd}
+	if s, ok := shells[path.Base(cmd[0])]; ok {
+		custom.pipefail = s.pipefail
+	}
+	return custom
+}
+
+// entrypoint returns the container entrypoint that
+// executes a build script in string format.
+func (s *shell) entrypoint() []string {
+	return append(append([]string{}, s.cmd...), "-e", "-c")
+}
+
+// String returns the interpreter command line, quoted
+// for use in a shell script.
+func (s *shell) String() string {
+	var parts []string
+	for _, arg := range s.cmd {
+		parts = append(parts, quote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quote quotes the argument for a shell script if it
+// contains characters other than a safe set.
+func quote(arg string) string {
+	safe := len(arg) != 0
+	for _, r := range arg {
+		if !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:+,@%", r) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
@@ -55,6 +55,12 @@ func trace(cmd string) string {
 // encode is a helper function that base64 encodes
 // a shell command (or entire script)
 func encode(script []byte) string {
+	return encodeShell(script, defaultShell)
+}
+
+// encodeShell is a helper function that base64 encodes
+// a script executed by the shell.
+func encodeShell(script []byte, sh *shell) string {
 	encoded := base64.StdEncoding.EncodeToString(script)
-	return fmt.Sprintf("echo %s | base64 -d | /bin/sh", encoded)
+	return fmt.Sprintf("echo %s | base64 -d | %s", encoded, sh)
 }
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/drone/drone-exec/docker"
 	"github.com/drone/drone-exec/parser"
 	"github.com/drone/drone-plugin-go/plugin"
 	yamljson "github.com/ghodss/yaml"
@@ -52,6 +53,20 @@ func toContainerConfig(n *parser.DockerNode) *dockerclient.ContainerConfig {
 	return config
 }
 
+// helper function that converts the secrets of the build
+// step to files, readable only by the owner.
+func toFiles(n *parser.DockerNode) []docker.File {
+	var files []docker.File
+	for _, file := range n.Secrets {
+		files = append(files, docker.File{
+			Path: file.Target,
+			Mode: 0400,
+			Data: []byte(file.Value),
+		})
+	}
+	return files
+}
+
 // helper function to inject drone-specific environment
 // variables into the container.
 func toEnv(s *State) []string {
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drone/drone-exec/yaml"
+)
+
+// schema writes the JSON Schema of the Yaml configuration
+// file to stdout.
+func schema() {
+	out, err := yaml.Schema()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(out)
+	os.Stdout.WriteString("\n")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/drone/drone-exec/yaml/secure"
+	"github.com/drone/drone-exec/yaml/shasum"
+
+	"gopkg.in/yaml.v2"
+)
+
+// secureCmd encrypts and decrypts the secure section of the
+// Yaml configuration file.
+func secureCmd(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: drone-exec secure encrypt|decrypt [flags] [file]")
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "encrypt":
+		encryptCmd(args[1:])
+	case "decrypt":
+		decryptCmd(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown secure command %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// encryptCmd reads the plaintext secure section, from the file
+// or stdin, and writes it encrypted with the public key to
+// stdout. The checksum of the Yaml file is computed if provided.
+func encryptCmd(args []string) {
+	flags := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	key := flags.String("key", "", "public key file")
+	conf := flags.String("yaml", "", "Yaml file to checksum")
+	algorithm := flags.String("checksum", "sha256", "checksum algorithm: sha1, sha256 or sha512")
+	flags.Parse(args)
+
+	in, err := readInput(flags.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	pub, err := ioutil.ReadFile(*key)
+	if err != nil {
+		fatal(err)
+	}
+
+	sec := &secure.Secure{}
+	err = yaml.Unmarshal(in, sec)
+	if err != nil {
+		fatal(err)
+	}
+	if len(*conf) != 0 {
+		raw, err := ioutil.ReadFile(*conf)
+		if err != nil {
+			fatal(err)
+		}
+		sec.Checksum, err = shasum.Sum(string(raw), filepath.Base(*conf), *algorithm)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	out, err := secure.Encrypt(sec, string(pub))
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Println(out)
+}
+
+// decryptCmd reads the encrypted secure section, from the file
+// or stdin, and writes the plaintext Yaml to stdout.
+func decryptCmd(args []string) {
+	flags := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	key := flags.String("key", "", "private key file")
+	flags.Parse(args)
+
+	in, err := readInput(flags.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	priv, err := ioutil.ReadFile(*key)
+	if err != nil {
+		fatal(err)
+	}
+	out, err := secure.Decrypt(string(in), string(priv))
+	if err != nil {
+		fatal(err)
+	}
+	os.Stdout.Write(out)
+}
+
+// readInput reads the file, or stdin if no file is provided.
+func readInput(file string) ([]byte, error) {
+	if len(file) == 0 {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(file)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
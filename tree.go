@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/drone/drone-exec/exec"
+	"github.com/drone/drone-plugin-go/plugin"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// tree writes the JSON encoded execution tree for the
+// payload to stdout, without running the build.
+func tree(opt exec.Options) {
+	var payload exec.Payload
+	if err := plugin.MustUnmarshal(&payload); err != nil {
+		log.Fatalln(err)
+	}
+
+	tree, err := exec.Tree(payload, opt)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	out, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	os.Stdout.Write(out)
+	os.Stdout.WriteString("\n")
+}
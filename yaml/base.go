@@ -0,0 +1,60 @@
+package yaml
+
+import "gopkg.in/yaml.v2"
+
+// Base is a typed representation of the base Yaml
+// configuration provided by the system. It defines
+// mandatory steps that run before and after the steps
+// of every repository, and locked values that override
+// the repository configuration.
+type Base struct {
+	Prepend Phases
+	Append  Phases
+	Locked  yaml.MapSlice
+}
+
+// Phases holds the mandatory steps for each phase of
+// the build.
+type Phases struct {
+	Compose Containerslice
+	Build   Buildslice
+	Publish Pluginslice
+	Deploy  Pluginslice
+	Notify  Pluginslice
+}
+
+// ParseBase parses a base Yaml configuration file.
+func ParseBase(in []byte) (*Base, error) {
+	b := Base{}
+	e := yaml.Unmarshal(in, &b)
+	return &b, e
+}
+
+// ParseBaseString parses a base Yaml configuration
+// file in string format.
+func ParseBaseString(in string) (*Base, error) {
+	return ParseBase([]byte(in))
+}
+
+// Lock merges the locked values into the Yaml configuration
+// file, replacing the values set by the repository. The
+// configuration is returned unchanged if no values are
+// locked.
+func (b *Base) Lock(in []byte) ([]byte, error) {
+	if len(b.Locked) == 0 {
+		return in, nil
+	}
+	doc := yaml.MapSlice{}
+	err := yaml.Unmarshal(in, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(mergeMap(doc, b.Locked))
+}
+
+// LockString merges the locked values into the Yaml
+// configuration file in string format.
+func (b *Base) LockString(in string) (string, error) {
+	out, err := b.Lock([]byte(in))
+	return string(out), err
+}
@@ -0,0 +1,61 @@
+package yaml
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestBase(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Base Yaml", func() {
+
+		g.It("Should parse mandatory steps", func() {
+			base, err := ParseBaseString(baseSample)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(base.Prepend.Build.Slice())).Equal(1)
+			g.Assert(base.Prepend.Build.Slice()[0].Name).Equal("license")
+			g.Assert(base.Prepend.Build.Slice()[0].Commands).Equal([]string{"scan"})
+			g.Assert(base.Append.Notify.Slice()[0].Vargs["url"]).Equal("http://audit")
+		})
+
+		g.It("Should override locked values", func() {
+			base, _ := ParseBaseString(baseSample)
+			out, err := base.LockString(sample)
+			g.Assert(err == nil).IsTrue()
+
+			conf, err := ParseString(out)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Build.Privileged).IsFalse()
+			g.Assert(conf.Build.Image).Equal("golang")
+			g.Assert(conf.Clone.Vargs["depth"]).Equal(50)
+		})
+
+		g.It("Should return the Yaml unchanged without locked values", func() {
+			base, _ := ParseBaseString("")
+			out, err := base.LockString(sample)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(out).Equal(sample)
+		})
+	})
+}
+
+var baseSample = `
+prepend:
+  build:
+    license:
+      image: license/scan
+      commands:
+        - scan
+append:
+  notify:
+    audit:
+      image: plugins/webhook
+      url: http://audit
+locked:
+  build:
+    privileged: false
+  clone:
+    depth: 50
+`
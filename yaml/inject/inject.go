@@ -1,7 +1,7 @@
 package inject
 
 import (
-	"sort"
+	"fmt"
 
 	"gopkg.in/yaml.v2"
 )
@@ -10,60 +10,276 @@ import (
 // the resulting string.
 //
 // Parameters are represented in the string using $$ notation, similar
-// to how environment variables are defined in Makefiles.
-func Inject(raw string, params map[string]string) string {
+// to how environment variables are defined in Makefiles, and support
+// the bash parameter expansion forms. An error is returned if a
+// required parameter, such as $${NAME:?word}, is empty.
+func Inject(raw string, params map[string]string) (string, error) {
 	if params == nil || len(params) == 0 {
-		return raw
+		return raw, nil
 	}
-	keys := []string{}
-	for k := range params {
-		keys = append(keys, k)
+	e := &expander{params: params}
+	out := e.expand(raw)
+	if e.err != nil {
+		return raw, e.err
 	}
-	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
-	injected := raw
-	for _, k := range keys {
-		v := params[k]
+	return out, nil
+}
 
-		for _, substitute := range substitutors {
-			injected = substitute(injected, k, v)
-		}
-	}
-	return injected
+// Policy defines the parts of the Yaml file that are protected
+// from parameter injection by InjectSafe, since a step could print
+// the injected values.
+type Policy struct {
+	// Sections lists the top-level sections that are protected
+	// entirely.
+	Sections []string `json:"sections"`
+
+	// Fields lists the protected fields of the steps in each
+	// section. The fields listed for "*" are protected in every
+	// section.
+	Fields map[string][]string `json:"fields"`
+}
+
+// DefaultPolicy protects the build, compose and templates sections,
+// which run arbitrary commands, and the plugin fields that execute
+// shell commands.
+var DefaultPolicy = &Policy{
+	Sections: []string{"build", "compose", "templates"},
+	Fields: map[string][]string{
+		"*": {"entrypoint", "command", "commands", "script"},
+	},
+}
+
+// stepSections lists the sections that contain a map of named
+// steps. Other sections, such as clone and cache, contain a
+// single step.
+var stepSections = map[string]bool{
+	"compose": true,
+	"publish": true,
+	"deploy":  true,
+	"notify":  true,
 }
 
 // InjectSafe attempts to safely inject parameters without leaking
-// parameters in the Build or Compose section of the yaml file.
+// parameters in the sections and fields protected by the default
+// policy.
 //
 // The intended use case for this function are public pull requests.
 // We want to avoid a malicious pull request that allows someone
 // to inject and print private variables.
 func InjectSafe(raw string, params map[string]string) (string, error) {
+	return InjectPolicy(raw, params, DefaultPolicy)
+}
+
+// InjectPolicy injects parameters without leaking parameters in
+// the sections and fields protected by the policy. A nil policy
+// uses the default policy.
+func InjectPolicy(raw string, params map[string]string, policy *Policy) (string, error) {
 	if params == nil || len(params) == 0 {
 		return raw, nil
 	}
+	injected, err := Inject(raw, params)
+	if err != nil {
+		return raw, err
+	}
+	return Protect(raw, injected, policy)
+}
+
+// Protect restores the sections and fields protected by the policy
+// in the injected Yaml file from the Yaml file before injection. A
+// nil policy uses the default policy.
+func Protect(raw, injected string, policy *Policy) (string, error) {
+	if policy == nil {
+		policy = DefaultPolicy
+	}
 	before, err := parse(raw)
 	if err != nil {
 		return raw, err
 	}
-	after, err := parse(Inject(raw, params))
+	after, err := parse(injected)
 	if err != nil {
 		return raw, err
 	}
-	after.Build = before.Build
+	for i, section := range after {
+		name := fmt.Sprint(section.Key)
+		prev := lookup(before, name)
+		if contains(policy.Sections, name) {
+			after[i].Value = prev
+			continue
+		}
+		fields := append(append([]string{}, policy.Fields["*"]...), policy.Fields[name]...)
+		if len(fields) == 0 {
+			continue
+		}
+		if !stepSections[name] {
+			after[i].Value = protect(section.Value, prev, fields)
+			continue
+		}
+		steps, ok := section.Value.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		prevSteps, _ := prev.(yaml.MapSlice)
+		for j, step := range steps {
+			steps[j].Value = protect(step.Value, lookup(prevSteps, fmt.Sprint(step.Key)), fields)
+		}
+	}
 	result, err := yaml.Marshal(after)
 	return string(result), err
 }
 
-// parse unmarshals the yaml file into an intermediate representation
-// that isolates the build section. This allows us to modify the rest
-// of the Yaml file while preserving the build section.
-func parse(raw string) (*config, error) {
-	conf := &config{}
+// defaultImages defines the image of the steps that may be
+// declared without an image.
+var defaultImages = map[string]string{
+	"clone": "plugins/drone-git",
+	"cache": "plugins/drone-cache",
+}
+
+// InjectSteps injects parameters into the steps of the Yaml file.
+// A parameter is only injected into a step if the allow function
+// returns true for the parameter name and the image of the step.
+// References in other steps, and outside of the steps, are left
+// unchanged.
+//
+// The image of each step is read from the resolved Yaml file,
+// with the includes and templates expanded, since a template
+// may replace the image of the step.
+func InjectSteps(raw, resolved string, params map[string]string, allow func(name, image string) bool) (string, error) {
+	if params == nil || len(params) == 0 {
+		return raw, nil
+	}
+	conf, err := parse(raw)
+	if err != nil {
+		return raw, err
+	}
+	final, err := parse(resolved)
+	if err != nil {
+		return raw, err
+	}
+	for i, section := range conf {
+		name := fmt.Sprint(section.Key)
+		switch {
+		case name == "build" || name == "clone" || name == "cache":
+			image := imageOf(lookup(final, name), defaultImages[name])
+			conf[i].Value, err = injectStep(section.Value, image, params, allow)
+			if err != nil {
+				return raw, err
+			}
+		case stepSections[name]:
+			steps, ok := section.Value.(yaml.MapSlice)
+			if !ok {
+				continue
+			}
+			finalSteps, _ := lookup(final, name).(yaml.MapSlice)
+			for j, step := range steps {
+				key := fmt.Sprint(step.Key)
+				image := imageOf(lookup(finalSteps, key), key)
+				steps[j].Value, err = injectStep(step.Value, image, params, allow)
+				if err != nil {
+					return raw, err
+				}
+			}
+		}
+	}
+	result, err := yaml.Marshal(conf)
+	return string(result), err
+}
+
+// imageOf returns the image of the step, or the default
+// image if the step does not define one.
+func imageOf(step interface{}, image string) string {
+	m, _ := step.(yaml.MapSlice)
+	if val, ok := lookup(m, "image").(string); ok && len(val) != 0 {
+		return val
+	}
+	return image
+}
+
+// injectStep injects the parameters allowed for the image of
+// the step into its values.
+func injectStep(step interface{}, image string, params map[string]string, allow func(name, image string) bool) (interface{}, error) {
+	m, ok := step.(yaml.MapSlice)
+	if !ok {
+		return step, nil
+	}
+	allowed := map[string]string{}
+	for k, v := range params {
+		if allow(k, image) {
+			allowed[k] = v
+		}
+	}
+	return injectValue(m, allowed)
+}
+
+// injectValue injects the parameters into the string values
+// of a decoded Yaml value.
+func injectValue(v interface{}, params map[string]string) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case string:
+		return Inject(v, params)
+	case yaml.MapSlice:
+		for i, item := range v {
+			v[i].Value, err = injectValue(item.Value, params)
+			if err != nil {
+				return v, err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i], err = injectValue(item, params)
+			if err != nil {
+				return v, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// protect restores the protected fields of the step from the
+// step before injection, removing fields that did not exist.
+func protect(step, prev interface{}, fields []string) interface{} {
+	m, ok := step.(yaml.MapSlice)
+	if !ok {
+		return step
+	}
+	p, _ := prev.(yaml.MapSlice)
+	out := yaml.MapSlice{}
+	for _, item := range m {
+		key := fmt.Sprint(item.Key)
+		if contains(fields, key) {
+			item.Value = lookup(p, key)
+			if item.Value == nil {
+				continue
+			}
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// parse unmarshals the yaml file into an ordered map, which
+// allows us to modify parts of the Yaml file while preserving
+// the protected sections and fields.
+func parse(raw string) (yaml.MapSlice, error) {
+	conf := yaml.MapSlice{}
 	err := yaml.Unmarshal([]byte(raw), &conf)
 	return conf, err
 }
 
-type config struct {
-	Build map[string]interface{} `yaml:"build"`
-	Vargs map[string]interface{} `yaml:"vargs,inline"`
+func lookup(m yaml.MapSlice, key string) interface{} {
+	for _, item := range m {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
 }
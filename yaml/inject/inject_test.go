@@ -16,41 +16,41 @@ func Test_Inject(t *testing.T) {
 			s := "echo $$FOO $BAR"
 			m := map[string]string{}
 			m["FOO"] = "BAZ"
-			g.Assert("echo BAZ $BAR").Equal(Inject(s, m))
+			g.Assert("echo BAZ $BAR").Equal(inject(s, m))
 		})
 
 		g.It("Should not replace vars with single $", func() {
 			s := "echo $FOO $BAR"
 			m := map[string]string{}
 			m["FOO"] = "BAZ"
-			g.Assert(s).Equal(Inject(s, m))
+			g.Assert(s).Equal(inject(s, m))
 		})
 
 		g.It("Should not replace vars in nil map", func() {
 			s := "echo $$FOO $BAR"
-			g.Assert(s).Equal(Inject(s, nil))
+			g.Assert(s).Equal(inject(s, nil))
 		})
 
 		g.It("Should escape quoted variables", func() {
 			s := `echo "$$FOO"`
 			m := map[string]string{}
 			m["FOO"] = "hello\nworld"
-			g.Assert(`echo "hello\nworld"`).Equal(Inject(s, m))
+			g.Assert(`echo "hello\nworld"`).Equal(inject(s, m))
 		})
 
 		g.It("Should replace variable prefix", func() {
-			s := `tag: $${TAG=$${SHA:8}}`
+			s := `tag: $${TAG:=$${SHA:8}}`
 			m := map[string]string{}
 			m["TAG"] = ""
 			m["SHA"] = "f36cbf54ee1a1eeab264c8e388f386218ab1701b"
-			g.Assert("tag: f36cbf54").Equal(Inject(s, m))
+			g.Assert("tag: f36cbf54").Equal(inject(s, m))
 		})
 
 		g.It("Should handle nested substitution operations", func() {
 			s := `echo "$${TAG##v}"`
 			m := map[string]string{}
 			m["TAG"] = "v1.0.0"
-			g.Assert(`echo "1.0.0"`).Equal(Inject(s, m))
+			g.Assert(`echo "1.0.0"`).Equal(inject(s, m))
 		})
 
 		g.It("Should safely inject params", func() {
@@ -97,9 +97,118 @@ func Test_Inject(t *testing.T) {
 			g.Assert(after.Notify.Slack.Token).Equal("FOO")
 			g.Assert(after.Notify.Slack.Secret).Equal("BAR")
 		})
+
+		g.It("Should not inject params in protected fields", func() {
+			m := map[string]string{"SECRET": "BAR"}
+			s, err := InjectSafe(attack, m)
+			g.Assert(err == nil).IsTrue()
+
+			conf := yaml.MapSlice{}
+			yaml.Unmarshal([]byte(s), &conf)
+			g.Assert(get(conf, "compose", "redis", "command")).Equal("echo $$SECRET")
+			g.Assert(get(conf, "compose", "redis", "entrypoint")).Equal([]interface{}{"/bin/sh", "-c", "echo $$SECRET"})
+			g.Assert(get(conf, "templates", "evil", "commands")).Equal([]interface{}{"echo $$SECRET"})
+			g.Assert(get(conf, "clone", "commands")).Equal([]interface{}{"echo $$SECRET"})
+			g.Assert(get(conf, "deploy", "ssh", "commands")).Equal([]interface{}{"echo $$SECRET"})
+			g.Assert(get(conf, "deploy", "ssh", "script")).Equal("echo $$SECRET")
+			g.Assert(get(conf, "notify", "webhook", "entrypoint")).Equal("echo $$SECRET")
+			g.Assert(get(conf, "notify", "webhook", "command")).Equal("$$SECRET")
+			g.Assert(get(conf, "deploy", "ssh", "password")).Equal("BAR")
+		})
+
+		g.It("Should preserve step ordering", func() {
+			s, _ := InjectSafe(before, map[string]string{"TOKEN": "FOO"})
+			conf := yaml.MapSlice{}
+			yaml.Unmarshal([]byte(s), &conf)
+			var keys []interface{}
+			for _, item := range conf {
+				keys = append(keys, item.Key)
+			}
+			g.Assert(keys).Equal([]interface{}{"build", "deploy", "publish", "notify"})
+		})
+
+		g.It("Should inject params using a custom policy", func() {
+			policy := &Policy{
+				Sections: []string{"build"},
+				Fields: map[string][]string{
+					"deploy": {"password"},
+				},
+			}
+			s, err := InjectPolicy(attack, map[string]string{"SECRET": "BAR"}, policy)
+			g.Assert(err == nil).IsTrue()
+
+			conf := yaml.MapSlice{}
+			yaml.Unmarshal([]byte(s), &conf)
+			g.Assert(get(conf, "compose", "redis", "command")).Equal("echo BAR")
+			g.Assert(get(conf, "deploy", "ssh", "password")).Equal("$$SECRET")
+			g.Assert(get(conf, "deploy", "ssh", "script")).Equal("echo BAR")
+		})
+
+		g.It("Should inject params into allowed steps", func() {
+			allow := func(name, image string) bool {
+				return image == "heroku"
+			}
+			s, err := InjectSteps(before, before, map[string]string{"TOKEN": "FOO"}, allow)
+			g.Assert(err == nil).IsTrue()
+
+			conf := yaml.MapSlice{}
+			yaml.Unmarshal([]byte(s), &conf)
+			g.Assert(get(conf, "deploy", "heroku", "token")).Equal("FOO")
+			g.Assert(get(conf, "build", "commands")).Equal([]interface{}{"echo $$TOKEN", "echo $$SECRET"})
+		})
+
+		g.It("Should use the image of the step", func() {
+			allow := func(name, image string) bool {
+				return image == "foo"
+			}
+			s, err := InjectSteps(before, before, map[string]string{"TOKEN": "FOO"}, allow)
+			g.Assert(err == nil).IsTrue()
+
+			conf := yaml.MapSlice{}
+			yaml.Unmarshal([]byte(s), &conf)
+			g.Assert(get(conf, "build", "commands")).Equal([]interface{}{"echo FOO", "echo $$SECRET"})
+			g.Assert(get(conf, "deploy", "heroku", "token")).Equal("$$TOKEN")
+		})
+
+		g.It("Should use the image of the resolved step", func() {
+			allow := func(name, image string) bool {
+				return image == "docker"
+			}
+			s, err := InjectSteps(extends, resolved, map[string]string{"TOKEN": "FOO"}, allow)
+			g.Assert(err == nil).IsTrue()
+
+			conf := yaml.MapSlice{}
+			yaml.Unmarshal([]byte(s), &conf)
+			g.Assert(get(conf, "publish", "docker", "password")).Equal("$$TOKEN")
+			g.Assert(get(conf, "publish", "registry", "password")).Equal("FOO")
+		})
+
+		g.It("Should protect fields after injection", func() {
+			injected := inject(attack, map[string]string{"SECRET": "BAR"})
+			s, err := Protect(attack, injected, nil)
+			g.Assert(err == nil).IsTrue()
+
+			conf := yaml.MapSlice{}
+			yaml.Unmarshal([]byte(s), &conf)
+			g.Assert(get(conf, "deploy", "ssh", "script")).Equal("echo $$SECRET")
+			g.Assert(get(conf, "deploy", "ssh", "password")).Equal("BAR")
+		})
 	})
 }
 
+// get returns the value at the path of keys.
+func get(conf yaml.MapSlice, keys ...string) interface{} {
+	var val interface{} = conf
+	for _, key := range keys {
+		m, ok := val.(yaml.MapSlice)
+		if !ok {
+			return nil
+		}
+		val = lookup(m, key)
+	}
+	return val
+}
+
 var before = `
 build:
   image: foo
@@ -119,3 +228,52 @@ notify:
     token: $$TOKEN
     secret: $$SECRET
 `
+
+var attack = `
+compose:
+  redis:
+    image: redis
+    command: echo $$SECRET
+    entrypoint: [ /bin/sh, -c, echo $$SECRET ]
+templates:
+  evil:
+    commands:
+      - echo $$SECRET
+clone:
+  commands:
+    - echo $$SECRET
+deploy:
+  ssh:
+    password: $$SECRET
+    commands:
+      - echo $$SECRET
+    script: echo $$SECRET
+notify:
+  webhook:
+    entrypoint: echo $$SECRET
+    command: $$SECRET
+`
+
+var extends = `
+templates:
+  evil:
+    image: evil/exfiltrate
+
+publish:
+  docker:
+    extends: evil
+    password: $$TOKEN
+  registry:
+    image: docker
+    password: $$TOKEN
+`
+
+var resolved = `
+publish:
+  docker:
+    image: evil/exfiltrate
+    password: $$TOKEN
+  registry:
+    image: docker
+    password: $$TOKEN
+`
@@ -1,186 +1,573 @@
 package inject
 
 import (
+	"bytes"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-// these are helper functions that bring bash-substitution
-// to the drone yaml file.
+// these are helper functions that bring bash parameter
+// expansion to the drone yaml file.
 // see http://tldp.org/LDP/abs/html/parameter-substitution.html
+//
+// The following forms are supported:
+//
+//   $$NAME, $${NAME}          the parameter value
+//   $${#NAME}                 the length of the value
+//   $${NAME:-word}            word if the value is empty
+//   $${NAME:=word}            word if the value is empty, which is
+//                             also assigned to the parameter
+//   $${NAME:+word}            word if the value is not empty
+//   $${NAME:?word}            an error with the message word if the
+//                             value is empty
+//   $${NAME#pattern}          the value minus the shortest prefix
+//   $${NAME##pattern}         the value minus the longest prefix
+//   $${NAME%pattern}          the value minus the shortest suffix
+//   $${NAME%%pattern}         the value minus the longest suffix
+//   $${NAME/pattern/string}   the first match replaced
+//   $${NAME//pattern/string}  every match replaced
+//   $${NAME/#pattern/string}  a matching prefix replaced
+//   $${NAME/%pattern/string}  a matching suffix replaced
+//   $${NAME^pattern}          the first character in upper case
+//   $${NAME^^pattern}         every character in upper case
+//   $${NAME,pattern}          the first character in lower case
+//   $${NAME,,pattern}         every character in lower case
+//   $${NAME:length}           the first length characters
+//   $${NAME:offset:length}    the substring at offset
+//
+// Patterns use the shell glob syntax. Words may contain nested
+// parameters, and a backslash escapes the next character. A
+// literal $$ is written as $$$$, which is never expanded and is
+// replaced with $$ by Unescape once every parameter is injected.
+//
+// Parameters are injected in several passes, for example secrets
+// and then build parameters, so a reference to a parameter that
+// is not in the map is left unchanged. For the same reason an
+// unset parameter cannot be told apart from a parameter set by
+// a later pass, and the forms without a colon, such as
+// $${NAME-word}, which test whether the parameter is unset, are
+// not supported and are left unchanged. Unlike
+// bash, $${NAME:length} returns the first characters of the value,
+// which is commonly used to shorten commit hashes.
 
-type substituteFunc func(str, key, val string) string
-
-var substitutors = []substituteFunc{
-	substituteQ,
-	substitute,
-	substituteBracket,
-	substitutePrefix,
-	substituteSuffix,
-	substituteDefault,
-	substituteReplace,
-	substituteLeft,
-	substituteSubstr,
-}
-
-// substitute is a helper function that substitutes
-// a simple parameter using $parameter notation.
-func substitute(str, key, val string) string {
-	key = fmt.Sprintf("$$%s", key)
-	return strings.Replace(str, key, val, -1)
-}
-
-// substituteQ is a helper function that substitutes
-// a simple parameter using "$parameter" notation with
-// the escaped value, using %q.
-func substituteQ(str, key, val string) string {
-	key = fmt.Sprintf(`"$$%s"`, key)
-	val = fmt.Sprintf("%q", val)
-	return strings.Replace(str, key, val, -1)
-}
-
-// substituteBracket is a helper function that substitutes
-// paramters using ${parameter} notation with the value.
-func substituteBracket(str, key, val string) string {
-	key = fmt.Sprintf("$${%s}", key)
-	return strings.Replace(str, key, val, -1)
-}
-
-// substitutePrefix is a helper function that substitutes
-// paramters using ${parameter##prefix} notation with the
-// parameter value minus the trimmed prefix.
-func substitutePrefix(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s##(.+)}", key)
-	reg, err := regexp.Compile(key)
-	if err != nil {
-		return str
-	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 2 {
+// expander expands the parameter references in a string.
+type expander struct {
+	params   map[string]string
+	assigned map[string]string // parameters assigned using :=
+	err      error             // first error reported using :?
+}
+
+// expand expands the parameter references in the string. A
+// quoted parameter, such as "$$NAME", is replaced with the
+// quoted and escaped value.
+func (e *expander) expand(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); {
+		j := strings.Index(s[i:], "$$")
+		if j < 0 {
+			buf.WriteString(s[i:])
+			break
+		}
+		start := i + j
+		if strings.HasPrefix(s[start:], escape) {
+			buf.WriteString(s[i : start+len(escape)])
+			i = start + len(escape)
+			continue
+		}
+		r, end, ok := parseRef(s, start)
+		if !ok {
+			buf.WriteString(s[i : start+2])
+			i = start + 2
 			continue
 		}
-		val_ := strings.TrimPrefix(val, match[1])
-		str = strings.Replace(str, match[0], val_, -1)
+		val, ok := e.eval(r)
+		quoted := ok && start > i && s[start-1] == '"' && end < len(s) && s[end] == '"'
+		if quoted {
+			buf.WriteString(s[i : start-1])
+			buf.WriteString(strconv.Quote(val))
+			i = end + 1
+			continue
+		}
+		buf.WriteString(s[i:start])
+		buf.WriteString(val)
+		i = end
 	}
-	return str
+	return buf.String()
 }
 
-// substituteSuffix is a helper function that substitutes
-// paramters using ${parameter%%suffix} notation with the
-// parameter value minus the trimmed suffix.
-func substituteSuffix(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s%%%%(.+)}", key)
-	reg, err := regexp.Compile(key)
-	if err != nil {
-		return str
+func (e *expander) lookup(name string) (string, bool) {
+	if val, ok := e.assigned[name]; ok {
+		return val, true
+	}
+	val, ok := e.params[name]
+	return val, ok
+}
+
+// ref is a parameter reference.
+type ref struct {
+	src  string // source text, kept if the parameter is not set
+	name string
+	op   string
+	arg  word // default word or pattern
+	with word // replacement string
+
+	offset, length int
+	hasLength      bool
+}
+
+// word is a sequence of text and nested parameter references.
+type word []part
+
+type part struct {
+	text    string
+	escaped bool // escaped text is never a pattern
+	ref     *ref
+}
+
+// parseRef parses the parameter reference starting at the
+// $$ at position i. It returns the reference and the position
+// following it.
+func parseRef(s string, i int) (*ref, int, bool) {
+	if !strings.HasPrefix(s[i:], "$$") {
+		return nil, i, false
+	}
+	j := i + 2
+	if j < len(s) && s[j] == '{' {
+		return parseBrace(s, i)
+	}
+	n := scanName(s, j)
+	if n == j {
+		return nil, i, false
+	}
+	return &ref{src: s[i:n], name: s[j:n]}, n, true
+}
+
+// parseBrace parses a $${...} reference starting at the $$
+// at position i.
+func parseBrace(s string, i int) (*ref, int, bool) {
+	j := i + 3
+	r := &ref{}
+	if j < len(s) && s[j] == '#' {
+		n := scanName(s, j+1)
+		if n > j+1 && n < len(s) && s[n] == '}' {
+			r.name, r.op, r.src = s[j+1:n], "len", s[i:n+1]
+			return r, n + 1, true
+		}
 	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 2 {
+	n := scanName(s, j)
+	if n == j {
+		return nil, i, false
+	}
+	r.name = s[j:n]
+	j = n
+
+	r.op = scanOp(s, j)
+	j += len(r.op)
+
+	var ok bool
+	switch r.op {
+	case "":
+	case ":":
+		j, ok = parseSubstr(s, j, r)
+		if !ok {
+			return nil, i, false
+		}
+	case "/", "//", "/#", "/%":
+		r.arg, j, ok = parseWord(s, j, "/}")
+		if !ok {
+			return nil, i, false
+		}
+		if s[j] == '/' {
+			r.with, j, ok = parseWord(s, j+1, "}")
+			if !ok {
+				return nil, i, false
+			}
+		}
+	default:
+		r.arg, j, ok = parseWord(s, j, "}")
+		if !ok {
+			return nil, i, false
+		}
+	}
+	if j >= len(s) || s[j] != '}' {
+		return nil, i, false
+	}
+	r.src = s[i : j+1]
+	return r, j + 1, true
+}
+
+// ops lists the operators, longest first.
+var ops = []string{
+	":-", ":=", ":+", ":?",
+	"##", "#", "%%", "%",
+	"//", "/#", "/%", "/",
+	"^^", "^", ",,", ",",
+	":",
+}
+
+func scanOp(s string, i int) string {
+	for _, op := range ops {
+		if strings.HasPrefix(s[i:], op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func scanName(s string, i int) int {
+	j := i
+	for j < len(s) {
+		c := s[j]
+		if c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || j > i && c >= '0' && c <= '9' {
+			j++
 			continue
 		}
-		val_ := strings.TrimSuffix(val, match[1])
-		str = strings.Replace(str, match[0], val_, -1)
+		break
 	}
-	return str
+	return j
 }
 
-// substituteDefault is a helper function that substitutes
-// paramters using ${parameter=default} notation with the
-// parameter value. When empty the default value is used.
-func substituteDefault(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s=(.+)}", key)
-	reg, err := regexp.Compile(key)
-	if err != nil {
-		return str
+// parseSubstr parses the offset and optional length of a
+// substring reference.
+func parseSubstr(s string, i int, r *ref) (int, bool) {
+	n, j, ok := parseInt(s, i)
+	if !ok {
+		return i, false
+	}
+	if j < len(s) && s[j] == ':' {
+		r.op = "::"
+		r.offset = n
+		r.length, j, ok = parseInt(s, j+1)
+		r.hasLength = true
+		return j, ok
+	}
+	if n < 0 {
+		r.op = "::"
+		r.offset = n
+		return j, true
+	}
+	r.length = n
+	return j, true
+}
+
+func parseInt(s string, i int) (int, int, bool) {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	j := i
+	if j < len(s) && s[j] == '-' {
+		j++
+	}
+	for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+		j++
 	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 2 {
+	n, err := strconv.Atoi(s[i:j])
+	return n, j, err == nil
+}
+
+// parseWord parses a word up to one of the terminating
+// characters. It returns the position of the terminator.
+func parseWord(s string, i int, stop string) (word, int, bool) {
+	var w word
+	var text bytes.Buffer
+	flush := func() {
+		if text.Len() != 0 {
+			w = append(w, part{text: text.String()})
+			text.Reset()
+		}
+	}
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case strings.IndexByte(stop, c) >= 0:
+			flush()
+			return w, i, true
+		case c == '\\' && i+1 < len(s):
+			flush()
+			_, size := utf8.DecodeRuneInString(s[i+1:])
+			w = append(w, part{text: s[i+1 : i+1+size], escaped: true})
+			i += 1 + size
 			continue
+		case strings.HasPrefix(s[i:], escape):
+			text.WriteString(escape)
+			i += len(escape)
+			continue
+		case c == '$':
+			if r, end, ok := parseRef(s, i); ok {
+				flush()
+				w = append(w, part{ref: r})
+				i = end
+				continue
+			}
 		}
+		text.WriteByte(c)
+		i++
+	}
+	return nil, i, false
+}
+
+// eval returns the value of the reference. If the parameter
+// is not set the source text is returned.
+func (e *expander) eval(r *ref) (string, bool) {
+	val, ok := e.lookup(r.name)
+	if !ok {
+		return r.src, false
+	}
+
+	switch r.op {
+	case "len":
+		return strconv.Itoa(utf8.RuneCountInString(val)), true
+	case ":-":
 		if len(val) == 0 {
-			str = strings.Replace(str, match[0], match[1], -1)
-		} else {
-			str = strings.Replace(str, match[0], val, -1)
+			return e.word(r.arg), true
+		}
+	case ":=":
+		if len(val) == 0 {
+			val = e.word(r.arg)
+			if e.assigned == nil {
+				e.assigned = map[string]string{}
+			}
+			e.assigned[r.name] = val
+		}
+	case ":+":
+		if len(val) != 0 {
+			return e.word(r.arg), true
 		}
+		return "", true
+	case ":?":
+		if len(val) == 0 {
+			if e.err == nil {
+				e.err = requiredError(r.name, e.word(r.arg))
+			}
+			return r.src, false
+		}
+	case "#", "##":
+		return trimPrefix(val, e.pattern(r.arg), r.op == "##"), true
+	case "%", "%%":
+		return trimSuffix(val, e.pattern(r.arg), r.op == "%%"), true
+	case "/", "//", "/#", "/%":
+		return replace(val, e.pattern(r.arg), e.word(r.with), r.op), true
+	case "^", "^^":
+		return changeCase(val, e.pattern(r.arg), r.op == "^^", unicode.ToUpper), true
+	case ",", ",,":
+		return changeCase(val, e.pattern(r.arg), r.op == ",,", unicode.ToLower), true
+	case ":":
+		return substr(val, 0, r.length, true), true
+	case "::":
+		return substr(val, r.offset, r.length, r.hasLength), true
 	}
-	return str
+	return val, true
 }
 
-// substituteReplace is a helper function that substitutes
-// paramters using ${parameter/old/new} notation with the
-// parameter value. A find and replace is performed before
-// injecting the strings, replacing the old pattern with the
-// new value.
-func substituteReplace(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s/(.+)/(.+)}", key)
-	reg, err := regexp.Compile(key)
-	if err != nil {
-		return str
+// requiredError returns the error reported by $${NAME:?word}
+// when the parameter is empty.
+func requiredError(name, msg string) error {
+	if len(msg) == 0 {
+		return fmt.Errorf("parameter %s is empty", name)
 	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 3 {
+	return fmt.Errorf("parameter %s: %s", name, msg)
+}
+
+// word returns the value of the word, expanding nested
+// references.
+func (e *expander) word(w word) string {
+	var buf bytes.Buffer
+	for _, p := range w {
+		if p.ref != nil {
+			val, _ := e.eval(p.ref)
+			buf.WriteString(val)
 			continue
 		}
-		with := strings.Replace(val, match[1], match[2], -1)
-		str = strings.Replace(str, match[0], with, -1)
+		buf.WriteString(p.text)
 	}
-	return str
+	return buf.String()
 }
 
-// substituteLeft is a helper function that substitutes
-// paramters using ${parameter:pos} notation with the
-// parameter value, sliced up to the specified position.
-func substituteLeft(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s:([0-9]*)}", key)
-	reg, err := regexp.Compile(key)
+// pattern returns the word as a regular expression matching
+// the complete string. Unescaped text uses the glob syntax,
+// while escaped text and parameter values match literally.
+// An empty pattern returns nil.
+func (e *expander) pattern(w word) *regexp.Regexp {
+	if len(w) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString("^(?s:")
+	for _, p := range w {
+		switch {
+		case p.ref != nil:
+			val, _ := e.eval(p.ref)
+			buf.WriteString(regexp.QuoteMeta(val))
+		case p.escaped:
+			buf.WriteString(regexp.QuoteMeta(p.text))
+		default:
+			buf.WriteString(globRegexp(p.text))
+		}
+	}
+	buf.WriteString(")$")
+	re, err := regexp.Compile(buf.String())
 	if err != nil {
-		return str
+		return regexp.MustCompile("^" + regexp.QuoteMeta(e.word(w)) + "$")
 	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 2 {
-			continue
+	return re
+}
+
+// globRegexp converts a shell glob to a regular expression.
+func globRegexp(glob string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteString(".")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				buf.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			buf.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
 		}
-		index, err := strconv.Atoi(match[1])
-		if err != nil {
-			continue // skip
+	}
+	return buf.String()
+}
+
+// bounds returns the character boundaries of the string,
+// including zero and the length of the string.
+func bounds(s string) []int {
+	var out []int
+	for i := range s {
+		out = append(out, i)
+	}
+	return append(out, len(s))
+}
+
+func trimPrefix(val string, re *regexp.Regexp, longest bool) string {
+	if re == nil {
+		return val
+	}
+	b := bounds(val)
+	for k := range b {
+		i := b[k]
+		if longest {
+			i = b[len(b)-1-k]
 		}
-		if index > len(val)-1 {
-			continue // skip
+		if re.MatchString(val[:i]) {
+			return val[i:]
 		}
+	}
+	return val
+}
 
-		str = strings.Replace(str, match[0], val[:index], -1)
+func trimSuffix(val string, re *regexp.Regexp, longest bool) string {
+	if re == nil {
+		return val
+	}
+	b := bounds(val)
+	for k := range b {
+		i := b[len(b)-1-k]
+		if longest {
+			i = b[k]
+		}
+		if re.MatchString(val[i:]) {
+			return val[:i]
+		}
 	}
-	return str
+	return val
 }
 
-// substituteLeft is a helper function that substitutes
-// paramters using ${parameter:pos:len} notation with the
-// parameter value as a substring, starting at the specified
-// position for the specified length.
-func substituteSubstr(str, key, val string) string {
-	key = fmt.Sprintf("\\$\\${%s:([0-9]*):([0-9]*)}", key)
-	reg, err := regexp.Compile(key)
-	if err != nil {
-		return str
+// replace replaces the longest match of the pattern. The op
+// selects whether the first match, every match, a prefix or a
+// suffix is replaced.
+func replace(val string, re *regexp.Regexp, with, op string) string {
+	if re == nil {
+		return val
 	}
-	for _, match := range reg.FindAllStringSubmatch(str, -1) {
-		if len(match) != 3 {
+	b := bounds(val)
+	var buf bytes.Buffer
+	last := 0
+	for k := 0; k < len(b); k++ {
+		start := b[k]
+		if start < last || op == "/#" && start != 0 {
 			continue
 		}
-		pos, err := strconv.Atoi(match[1])
-		if err != nil {
-			continue // skip
+		end := -1
+		for m := len(b) - 1; m >= k; m-- {
+			if op == "/%" && b[m] != len(val) {
+				continue
+			}
+			if re.MatchString(val[start:b[m]]) {
+				end = b[m]
+				break
+			}
 		}
-		length, err := strconv.Atoi(match[2])
-		if err != nil {
-			continue // skip
+		if end < 0 || end == start && op != "/#" && op != "/%" {
+			continue
 		}
-		if pos+length > len(val)-1 {
-			continue // skip
+		buf.WriteString(val[last:start])
+		buf.WriteString(with)
+		last = end
+		if op != "//" {
+			break
 		}
-		str = strings.Replace(str, match[0], val[pos:pos+length], -1)
 	}
-	return str
+	buf.WriteString(val[last:])
+	return buf.String()
+}
+
+// changeCase changes the case of the first character, or
+// every character, matching the pattern. An empty pattern
+// matches any character.
+func changeCase(val string, re *regexp.Regexp, all bool, fn func(rune) rune) string {
+	runes := []rune(val)
+	for i, r := range runes {
+		if re == nil || re.MatchString(string(r)) {
+			runes[i] = fn(r)
+		}
+		if !all {
+			break
+		}
+	}
+	return string(runes)
+}
+
+// substr returns the substring of the value at offset. A
+// negative offset counts from the end of the value, and a
+// negative length is the offset of the end from the end of
+// the value.
+func substr(val string, offset, length int, hasLength bool) string {
+	runes := []rune(val)
+	if offset < 0 {
+		offset += len(runes)
+	}
+	if offset < 0 || offset > len(runes) {
+		return ""
+	}
+	end := len(runes)
+	switch {
+	case !hasLength:
+	case length < 0:
+		end += length
+	default:
+		end = offset + length
+	}
+	if end > len(runes) {
+		end = len(runes)
+	}
+	if end < offset {
+		return ""
+	}
+	return string(runes[offset:end])
 }
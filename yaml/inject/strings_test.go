@@ -11,63 +11,156 @@ func Test_Substitution(t *testing.T) {
 	g := goblin.Goblin(t)
 	g.Describe("Parameter Substitution", func() {
 
+		params := map[string]string{
+			"GREETING": "HELLO",
+			"EMPTY":    "",
+			"FOO":      "THIS IS A REALLY LONG STRING",
+			"SHA":      "f36cbf54ee1a1eeab264c8e388f386218ab1701b",
+			"PATH":     "/usr/local/bin/drone",
+			"TAG":      "v1.0.0",
+			"LOWER":    "hello world",
+		}
+
+		expand := func(s string) string {
+			out, _ := Inject(s, params)
+			return out
+		}
+
 		g.It("Should not substitute single dollar sign", func() {
 			str := "echo $GREETING WORLD" // expects $$ notation
-			g.Assert(substitute(str, "GREETING", "HELLO")).Equal(str)
+			g.Assert(expand(str)).Equal(str)
 		})
 
 		g.It("Should substitute simple parameters", func() {
-			before := "echo $$GREETING WORLD"
-			after := "echo HELLO WORLD"
-			g.Assert(substitute(before, "GREETING", "HELLO")).Equal(after)
+			g.Assert(expand("echo $$GREETING WORLD")).Equal("echo HELLO WORLD")
+			g.Assert(expand("echo $${GREETING} WORLD")).Equal("echo HELLO WORLD")
+			g.Assert(expand("echo $${#GREETING}")).Equal("echo 5")
 		})
 
-		g.It("Should substitute quoted parameters", func() {
-			before := "echo $${GREETING} WORLD"
-			after := "echo HELLO WORLD"
-			g.Assert(substituteBracket(before, "GREETING", "HELLO")).Equal(after)
+		g.It("Should not substitute unknown parameters", func() {
+			g.Assert(expand("echo $$GREETINGS $${NAME:-world} $${NAME/a/b}")).Equal("echo $$GREETINGS $${NAME:-world} $${NAME/a/b}")
 		})
 
-		g.It("Should substitute parameters and trim prefix", func() {
-			before := "echo $${GREETING##asdf} WORLD"
-			after := "echo HELLO WORLD"
-			g.Assert(substitutePrefix(before, "GREETING", "asdfHELLO")).Equal(after)
+		g.It("Should substitute parameters using a default", func() {
+			g.Assert(expand("echo $${EMPTY:-HOLA} WORLD")).Equal("echo HOLA WORLD")
+			g.Assert(expand("echo $${GREETING:-HOLA} WORLD")).Equal("echo HELLO WORLD")
 		})
 
-		g.It("Should substitute parameters and trim suffix", func() {
-			before := "echo $${GREETING%%asdf} WORLD"
-			after := "echo HELLO WORLD"
-			g.Assert(substituteSuffix(before, "GREETING", "HELLOasdf")).Equal(after)
+		g.It("Should assign the default", func() {
+			g.Assert(expand("$${EMPTY:=HOLA} $$EMPTY")).Equal("HOLA HOLA")
 		})
 
-		g.It("Should substitute parameters without using the default", func() {
-			before := "echo $${GREETING=HOLA} WORLD"
-			after := "echo HELLO WORLD"
-			g.Assert(substituteDefault(before, "GREETING", "HELLO")).Equal(after)
+		g.It("Should substitute an alternate value", func() {
+			g.Assert(expand("$${GREETING:+set}")).Equal("set")
+			g.Assert(expand("$${EMPTY:+set}")).Equal("")
 		})
 
-		g.It("Should substitute parameters using the a default", func() {
-			before := "echo $${GREETING=HOLA} WORLD"
-			after := "echo HOLA WORLD"
-			g.Assert(substituteDefault(before, "GREETING", "")).Equal(after)
+		g.It("Should report required empty parameters", func() {
+			_, err := Inject("echo $${EMPTY:?is required}", params)
+			g.Assert(err.Error()).Equal("parameter EMPTY: is required")
+			_, err = Inject("echo $${EMPTY:?}", params)
+			g.Assert(err.Error()).Equal("parameter EMPTY is empty")
+			g.Assert(expand("$${GREETING:?required}")).Equal("HELLO")
+			g.Assert(expand("$${NAME:?required}")).Equal("$${NAME:?required}")
+		})
+
+		g.It("Should not substitute the forms without a colon", func() {
+			g.Assert(expand("$${EMPTY-HOLA} $${EMPTY=HOLA} $${GREETING+set} $${EMPTY?required}")).Equal("$${EMPTY-HOLA} $${EMPTY=HOLA} $${GREETING+set} $${EMPTY?required}")
+		})
+
+		g.It("Should substitute parameters and trim prefix", func() {
+			g.Assert(expand("$${TAG##v}")).Equal("1.0.0")
+			g.Assert(expand("$${PATH#*/}")).Equal("usr/local/bin/drone")
+			g.Assert(expand("$${PATH##*/}")).Equal("drone")
+		})
+
+		g.It("Should substitute parameters and trim suffix", func() {
+			g.Assert(expand("$${TAG%%.0}")).Equal("v1.0")
+			g.Assert(expand("$${TAG%.*}")).Equal("v1.0")
+			g.Assert(expand("$${TAG%%.*}")).Equal("v1")
 		})
 
 		g.It("Should substitute parameters with replacement", func() {
-			before := "echo $${GREETING/HE/A} MONDE"
-			after := "echo ALLO MONDE"
-			g.Assert(substituteReplace(before, "GREETING", "HELLO")).Equal(after)
+			g.Assert(expand("echo $${GREETING/HE/A} MONDE")).Equal("echo ALLO MONDE")
+			g.Assert(expand("$${TAG/./-}")).Equal("v1-0.0")
+			g.Assert(expand("$${TAG//./-}")).Equal("v1-0-0")
+			g.Assert(expand("$${TAG/#v/version }")).Equal("version 1.0.0")
+			g.Assert(expand("$${TAG/%0/x}")).Equal("v1.0.x")
+			g.Assert(expand("$${PATH//\\//_}")).Equal("_usr_local_bin_drone")
+			g.Assert(expand("$${TAG//[0-9]/N}")).Equal("vN.N.N")
+			g.Assert(expand("$${TAG//./}")).Equal("v100")
+		})
+
+		g.It("Should change the case", func() {
+			g.Assert(expand("$${LOWER^}")).Equal("Hello world")
+			g.Assert(expand("$${LOWER^^}")).Equal("HELLO WORLD")
+			g.Assert(expand("$${LOWER^^[lo]}")).Equal("heLLO wOrLd")
+			g.Assert(expand("$${GREETING,}")).Equal("hELLO")
+			g.Assert(expand("$${GREETING,,}")).Equal("hello")
 		})
 
 		g.It("Should substitute parameters with left substr", func() {
-			before := "echo $${FOO:4} IS COOL"
-			after := "echo THIS IS COOL"
-			g.Assert(substituteLeft(before, "FOO", "THIS IS A REALLY LONG STRING")).Equal(after)
+			g.Assert(expand("echo $${FOO:4} IS COOL")).Equal("echo THIS IS COOL")
+			g.Assert(expand("$${SHA:8}")).Equal("f36cbf54")
 		})
 
 		g.It("Should substitute parameters with substr", func() {
-			before := "echo $${FOO:8:5} IS COOL"
-			after := "echo DRONE IS COOL"
-			g.Assert(substituteSubstr(before, "FOO", "THIS IS DRONE CI")).Equal(after)
+			g.Assert(inject("echo $${FOO:8:5} IS COOL", map[string]string{"FOO": "THIS IS DRONE CI"})).Equal("echo DRONE IS COOL")
+			g.Assert(expand("$${TAG:1:3}")).Equal("1.0")
+			g.Assert(expand("$${TAG: -3}")).Equal("0.0")
+			g.Assert(expand("$${TAG:1:-2}")).Equal("1.0")
+			g.Assert(expand("$${TAG:10:2}")).Equal("")
+		})
+
+		g.It("Should expand nested defaults", func() {
+			g.Assert(expand("$${EMPTY:-$${MISSING:-$${SHA:8}}}")).Equal("$${MISSING:-$${SHA:8}}")
+			g.Assert(expand("$${EMPTY:-$${GREETING,,}-$$TAG}")).Equal("hello-v1.0.0")
+			g.Assert(expand("$${EMPTY:-a\\}b}")).Equal("a}b")
+		})
+
+		g.It("Should match escaped patterns literally", func() {
+			g.Assert(inject("$${A//\\*/x}", map[string]string{"A": "a*b*c"})).Equal("axbxc")
+			g.Assert(inject("$${A//*/x}", map[string]string{"A": "a*b*c"})).Equal("x")
+		})
+
+		g.It("Should leave malformed references unchanged", func() {
+			g.Assert(expand("$${GREETING")).Equal("$${GREETING")
+			g.Assert(expand("$${GREETING:x}")).Equal("$${GREETING:x}")
+			g.Assert(expand("$$ $${}")).Equal("$$ $${}")
+		})
+	})
+}
+
+func Test_Unresolved(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Unresolved parameters", func() {
+
+		g.It("Should report remaining references with a location", func() {
+			raw := "build:\n  commands:\n    - docker login -p $$DOCKER_PASSWORD\n    - echo $${TAG:-latest} $$$$LITERAL\n"
+			refs := Unresolved(inject(raw, map[string]string{"OTHER": "x"}))
+			g.Assert(len(refs)).Equal(2)
+			g.Assert(refs[0].String()).Equal("line 3, column 23: unresolved parameter $$DOCKER_PASSWORD")
+			g.Assert(refs[0].Name).Equal("DOCKER_PASSWORD")
+			g.Assert(refs[1].String()).Equal("line 4, column 12: unresolved parameter $${TAG:-latest}")
+		})
+
+		g.It("Should not expand escaped references", func() {
+			out := inject("echo $$$$HOME $$HOME", map[string]string{"HOME": "/root"})
+			g.Assert(out).Equal("echo $$$$HOME /root")
+			g.Assert(Unescape(out)).Equal("echo $$HOME /root")
+			g.Assert(len(Unresolved(out))).Equal(0)
+		})
+
+		g.It("Should not expand escaped references in words", func() {
+			out := inject("$${EMPTY:-$$$$HOME}", map[string]string{"EMPTY": ""})
+			g.Assert(Unescape(out)).Equal("$$HOME")
 		})
 	})
 }
+
+// inject injects the parameters, ignoring errors.
+func inject(raw string, params map[string]string) string {
+	out, _ := Inject(raw, params)
+	return out
+}
@@ -0,0 +1,86 @@
+package inject
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// escape is the escaped form of a literal $$.
+const escape = "$$$$"
+
+// Ref is a parameter reference left in the Yaml after the
+// parameters are injected, usually because a secret or matrix
+// variable is missing.
+type Ref struct {
+	Line   int
+	Column int
+	Name   string // parameter name, empty if malformed
+	Text   string // reference as written in the Yaml
+}
+
+func (r *Ref) String() string {
+	return fmt.Sprintf("line %d, column %d: unresolved parameter %s", r.Line, r.Column, r.Text)
+}
+
+// Unresolved returns the parameter references remaining in the
+// raw string, in order. Escaped references are ignored.
+func Unresolved(raw string) []*Ref {
+	var refs []*Ref
+	line, col := 1, 1
+	for i := 0; i < len(raw); {
+		switch {
+		case strings.HasPrefix(raw[i:], escape):
+			i += len(escape)
+			col += len(escape)
+			continue
+		case strings.HasPrefix(raw[i:], "$$"):
+			ref := &Ref{Line: line, Column: col, Text: "$$"}
+			r, end, ok := parseRef(raw, i)
+			if ok {
+				ref.Name, ref.Text = r.name, r.src
+			} else if name := scanName(raw, i+3); strings.HasPrefix(raw[i:], "$${") && name > i+3 {
+				ref.Name, ref.Text = raw[i+3:name], raw[i:name]
+			}
+			// references are only reported if they name a
+			// parameter, since a $$ may be part of a value.
+			if len(ref.Name) != 0 {
+				refs = append(refs, ref)
+			}
+			if ok {
+				line, col = advance(raw[i:end], line, col)
+				i = end
+				continue
+			}
+			i += 2
+			col += 2
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(raw[i:])
+		if r == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+		i += size
+	}
+	return refs
+}
+
+// advance returns the line and column following the text.
+func advance(text string, line, col int) (int, int) {
+	for _, r := range text {
+		if r == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+// Unescape replaces the escaped $$$$ with a literal $$. It
+// must be called once every parameter is injected.
+func Unescape(raw string) string {
+	return strings.Replace(raw, escape, "$$", -1)
+}
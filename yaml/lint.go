@@ -0,0 +1,555 @@
+package yaml
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Severity identifies the severity of a lint diagnostic.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem found when linting a Yaml
+// configuration file.
+type Diagnostic struct {
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+// Plugins lists the plugin aliases known to the linter. An
+// alias is expanded to the plugins/drone-<alias> image.
+var Plugins = []string{
+	"azure_storage",
+	"bintray",
+	"cache",
+	"cloudfoundry",
+	"coverage",
+	"docker",
+	"downstream",
+	"email",
+	"gcr",
+	"gcs",
+	"git",
+	"github_release",
+	"gitter",
+	"heroku",
+	"hg",
+	"hipchat",
+	"irc",
+	"marathon",
+	"npm",
+	"pypi",
+	"rancher",
+	"rsync",
+	"s3",
+	"s3_sync",
+	"slack",
+	"ssh",
+	"swift",
+	"webhook",
+}
+
+// Lint parses a Yaml configuration file and reports unknown
+// keys, values of the wrong type, empty images and unknown
+// plugin aliases, with the line and column of each problem.
+func Lint(in []byte) []*Diagnostic {
+	l := &linter{}
+	doc := yamlv3.Node{}
+	err := yamlv3.Unmarshal(in, &doc)
+	if err != nil {
+		l.diags = append(l.diags, parseErrorDiagnostic(err))
+		return l.diags
+	}
+	// unsupported versions are reported by checkVersion.
+	version, err := ParseVersion(in)
+	if err == nil && version < Version {
+		l.diags = append(l.diags, &Diagnostic{
+			Line:     1,
+			Column:   1,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("configuration uses version %d of the format, run drone-exec migrate to upgrade to version %d", version, Version),
+		})
+	}
+	if len(doc.Content) != 0 {
+		l.lintConfig(doc.Content[0])
+	}
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		if l.diags[i].Line != l.diags[j].Line {
+			return l.diags[i].Line < l.diags[j].Line
+		}
+		return l.diags[i].Column < l.diags[j].Column
+	})
+	return l.diags
+}
+
+// LintString lints a Yaml configuration file in string
+// format.
+func LintString(in string) []*Diagnostic {
+	return Lint([]byte(in))
+}
+
+var lineRegexp = regexp.MustCompile(`line (\d+)`)
+
+// parseErrorDiagnostic converts a Yaml syntax error to a
+// diagnostic, extracting the line number when available.
+func parseErrorDiagnostic(err error) *Diagnostic {
+	d := &Diagnostic{Severity: SeverityError, Message: err.Error()}
+	if match := lineRegexp.FindStringSubmatch(err.Error()); match != nil {
+		d.Line, _ = strconv.Atoi(match[1])
+	}
+	return d
+}
+
+// checkFunc validates the value of a Yaml key.
+type checkFunc func(l *linter, n *yamlv3.Node)
+
+// configKeys defines the top-level sections of the
+// configuration file.
+var configKeys = map[string]checkFunc{
+	"cache":   checkPlugin,
+	"clone":   checkPlugin,
+	"build":   checkBuild,
+	"compose": checkContainers,
+	"publish": checkPlugins,
+	"deploy":  checkPlugins,
+	"notify":  checkPlugins,
+	"debug":   checkBool,
+	"version": checkVersion,
+
+	"templates": checkTemplates,
+	"include":   checkStringorslice,
+}
+
+// containerKeys defines the keys of a container step.
+var containerKeys = map[string]checkFunc{
+	"image":       checkString,
+	"pull":        checkBool,
+	"privileged":  checkBool,
+	"environment": checkMapEqualSlice,
+	"entrypoint":  checkCommand,
+	"command":     checkCommand,
+	"extra_hosts": checkStrings,
+	"volumes":     checkStrings,
+	"net":         checkString,
+	"auth_config": checkAuthConfig,
+	"secrets":     checkSecretFiles,
+	"when":        checkFilter,
+	"extends":     checkString,
+}
+
+// buildKeys defines the keys of the build step, in
+// addition to the container keys.
+var buildKeys = map[string]checkFunc{
+	"commands": checkStrings,
+	"shell":    checkCommand,
+}
+
+// filterKeys defines the keys of the when section.
+var filterKeys = map[string]checkFunc{
+	"repo":    checkString,
+	"branch":  checkStringorslice,
+	"tag":     checkStringorslice,
+	"event":   checkStringorslice,
+	"success": checkString,
+	"failure": checkString,
+	"change":  checkString,
+	"matrix":  checkStringMap,
+	"expr":    checkString,
+}
+
+// authConfigKeys defines the keys of the auth_config section.
+var authConfigKeys = map[string]checkFunc{
+	"username":       checkString,
+	"password":       checkString,
+	"email":          checkString,
+	"registry_token": checkString,
+}
+
+// secretFileKeys defines the keys of a secret file.
+var secretFileKeys = map[string]checkFunc{
+	"source": checkString,
+	"target": checkString,
+}
+
+// pluginHintKeys defines the container keys suggested for
+// misspelled plugin keys. Short keys are excluded since they
+// resemble common plugin arguments, such as commands.
+var pluginHintKeys = map[string]checkFunc{
+	"image":       checkString,
+	"privileged":  checkBool,
+	"environment": checkMapEqualSlice,
+	"entrypoint":  checkCommand,
+	"extra_hosts": checkStrings,
+	"auth_config": checkAuthConfig,
+	"when":        checkFilter,
+}
+
+type linter struct {
+	diags []*Diagnostic
+}
+
+func (l *linter) report(n *yamlv3.Node, sev Severity, format string, args ...interface{}) {
+	l.diags = append(l.diags, &Diagnostic{
+		Line:     n.Line,
+		Column:   n.Column,
+		Severity: sev,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) errorf(n *yamlv3.Node, format string, args ...interface{}) {
+	l.report(n, SeverityError, format, args...)
+}
+
+func (l *linter) warnf(n *yamlv3.Node, format string, args ...interface{}) {
+	l.report(n, SeverityWarning, format, args...)
+}
+
+// lintConfig lints the top-level document. Unknown sections
+// are reported as warnings since they are commonly used to
+// declare Yaml anchors.
+func (l *linter) lintConfig(n *yamlv3.Node) {
+	if !l.expectMap(n, "configuration") {
+		return
+	}
+	eachKey(n, func(key, val *yamlv3.Node) {
+		check, ok := configKeys[key.Value]
+		if !ok {
+			l.warnf(key, "unknown section %s%s", key.Value, suggest(key.Value, configKeys))
+			return
+		}
+		check(l, val)
+	})
+}
+
+// lintKeys lints the keys of a mapping against the set of
+// known keys, reporting unknown keys as errors.
+func (l *linter) lintKeys(n *yamlv3.Node, what string, keys ...map[string]checkFunc) {
+	if !l.expectMap(n, what) {
+		return
+	}
+	eachKey(n, func(key, val *yamlv3.Node) {
+		for _, known := range keys {
+			if check, ok := known[key.Value]; ok {
+				check(l, val)
+				return
+			}
+		}
+		l.errorf(key, "unknown %s key %s%s", what, key.Value, suggest(key.Value, keys...))
+	})
+}
+
+func (l *linter) expectMap(n *yamlv3.Node, what string) bool {
+	if n.Kind != yamlv3.MappingNode {
+		l.errorf(n, "%s must be a map, found %s", what, kindName(n))
+		return false
+	}
+	return true
+}
+
+func checkBuild(l *linter, n *yamlv3.Node) {
+	l.lintKeys(n, "build", containerKeys, buildKeys)
+	if n.Kind != yamlv3.MappingNode {
+		return
+	}
+	image := lookup(n, "image")
+	commands := lookup(n, "commands")
+	if commands != nil && (image == nil || len(image.Value) == 0) {
+		l.errorf(n, "build must specify an image")
+	}
+}
+
+func checkContainers(l *linter, n *yamlv3.Node) {
+	if !l.expectMap(n, "compose") {
+		return
+	}
+	eachKey(n, func(key, val *yamlv3.Node) {
+		l.lintKeys(val, "compose", containerKeys)
+		l.checkImage(key, val, false)
+	})
+}
+
+func checkPlugins(l *linter, n *yamlv3.Node) {
+	if !l.expectMap(n, "plugin section") {
+		return
+	}
+	eachKey(n, func(key, val *yamlv3.Node) {
+		l.lintPlugin(key, val)
+	})
+}
+
+// checkTemplates lints the step templates. Templates may be
+// extended by any step, so they are linted as plugins.
+func checkTemplates(l *linter, n *yamlv3.Node) {
+	if !l.expectMap(n, "templates") {
+		return
+	}
+	eachKey(n, func(key, val *yamlv3.Node) {
+		l.lintPlugin(nil, val)
+	})
+}
+
+func checkPlugin(l *linter, n *yamlv3.Node) {
+	l.lintPlugin(nil, n)
+}
+
+// lintPlugin lints a plugin step. Unknown keys are passed
+// to the plugin as arguments, so only keys that resemble a
+// known key are reported, as warnings.
+func (l *linter) lintPlugin(key, n *yamlv3.Node) {
+	if !l.expectMap(n, "plugin") {
+		return
+	}
+	eachKey(n, func(k, val *yamlv3.Node) {
+		if check, ok := containerKeys[k.Value]; ok {
+			check(l, val)
+			return
+		}
+		if hint := suggest(k.Value, pluginHintKeys); len(hint) != 0 {
+			l.warnf(k, "unknown plugin key %s is passed to the plugin as an argument%s", k.Value, hint)
+		}
+	})
+	if key != nil {
+		l.checkImage(key, n, true)
+	}
+}
+
+// checkImage reports empty images, and unknown plugin
+// aliases, for a step declared with the given key.
+func (l *linter) checkImage(key, n *yamlv3.Node, plugin bool) {
+	node, image := key, key.Value
+	if val := lookup(n, "image"); val != nil {
+		if len(val.Value) == 0 {
+			l.errorf(val, "image must not be empty")
+			return
+		}
+		node, image = val, val.Value
+	}
+	if !plugin || strings.Contains(image, "/") {
+		return
+	}
+	alias := strings.SplitN(image, ":", 2)[0]
+	for _, name := range Plugins {
+		if name == alias {
+			return
+		}
+	}
+	l.warnf(node, "unknown plugin %s", alias)
+}
+
+func checkFilter(l *linter, n *yamlv3.Node) {
+	l.lintKeys(n, "when", filterKeys)
+}
+
+func checkAuthConfig(l *linter, n *yamlv3.Node) {
+	l.lintKeys(n, "auth_config", authConfigKeys)
+}
+
+// checkSecretFiles lints the secrets mounted as files. The
+// source is required and the target must be absolute.
+func checkSecretFiles(l *linter, n *yamlv3.Node) {
+	if n.Kind != yamlv3.SequenceNode {
+		l.errorf(n, "expected a list, found %s", kindName(n))
+		return
+	}
+	for _, item := range n.Content {
+		item = resolve(item)
+		l.lintKeys(item, "secret", secretFileKeys)
+		if item.Kind != yamlv3.MappingNode {
+			continue
+		}
+		if source := lookup(item, "source"); source == nil || len(source.Value) == 0 {
+			l.errorf(item, "secret must specify a source")
+		}
+		if target := lookup(item, "target"); target != nil && !strings.HasPrefix(target.Value, "/") {
+			l.errorf(target, "secret target %s must be an absolute path", target.Value)
+		}
+	}
+}
+
+func checkString(l *linter, n *yamlv3.Node) {
+	if n.Kind != yamlv3.ScalarNode {
+		l.errorf(n, "expected a string, found %s", kindName(n))
+	}
+}
+
+func checkBool(l *linter, n *yamlv3.Node) {
+	if n.Kind != yamlv3.ScalarNode {
+		l.errorf(n, "expected a boolean, found %s", kindName(n))
+		return
+	}
+	switch strings.ToLower(n.Value) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n":
+		return
+	}
+	l.errorf(n, "expected a boolean, found %q", n.Value)
+}
+
+func checkVersion(l *linter, n *yamlv3.Node) {
+	if n.Kind != yamlv3.ScalarNode {
+		l.errorf(n, "expected a version number, found %s", kindName(n))
+		return
+	}
+	v, err := strconv.Atoi(n.Value)
+	if err != nil || v < 1 || v > Version {
+		l.errorf(n, "unsupported version %s, expected a version between 1 and %d", n.Value, Version)
+	}
+}
+
+func checkStrings(l *linter, n *yamlv3.Node) {
+	if n.Kind != yamlv3.SequenceNode {
+		l.errorf(n, "expected a list, found %s", kindName(n))
+		return
+	}
+	for _, item := range n.Content {
+		checkString(l, resolve(item))
+	}
+}
+
+func checkStringorslice(l *linter, n *yamlv3.Node) {
+	if n.Kind == yamlv3.ScalarNode {
+		return
+	}
+	checkStrings(l, n)
+}
+
+func checkCommand(l *linter, n *yamlv3.Node) {
+	checkStringorslice(l, n)
+}
+
+func checkStringMap(l *linter, n *yamlv3.Node) {
+	if !l.expectMap(n, "value") {
+		return
+	}
+	eachKey(n, func(key, val *yamlv3.Node) {
+		checkString(l, val)
+	})
+}
+
+func checkMapEqualSlice(l *linter, n *yamlv3.Node) {
+	if n.Kind == yamlv3.SequenceNode {
+		checkStrings(l, n)
+		return
+	}
+	checkStringMap(l, n)
+}
+
+// eachKey calls fn for each key and value in the mapping,
+// following aliases and merge keys.
+func eachKey(n *yamlv3.Node, fn func(key, val *yamlv3.Node)) {
+	n = resolve(n)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], resolve(n.Content[i+1])
+		if key.Value == "<<" && key.Tag == "!!merge" {
+			eachMerge(val, fn)
+			continue
+		}
+		fn(key, val)
+	}
+}
+
+func eachMerge(n *yamlv3.Node, fn func(key, val *yamlv3.Node)) {
+	switch n.Kind {
+	case yamlv3.MappingNode:
+		eachKey(n, fn)
+	case yamlv3.SequenceNode:
+		for _, item := range n.Content {
+			eachKey(resolve(item), fn)
+		}
+	}
+}
+
+// lookup returns the value of the key in the mapping.
+func lookup(n *yamlv3.Node, name string) *yamlv3.Node {
+	var found *yamlv3.Node
+	eachKey(n, func(key, val *yamlv3.Node) {
+		if key.Value == name {
+			found = val
+		}
+	})
+	return found
+}
+
+// resolve returns the node referenced by an alias.
+func resolve(n *yamlv3.Node) *yamlv3.Node {
+	for n.Kind == yamlv3.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	return n
+}
+
+func kindName(n *yamlv3.Node) string {
+	switch n.Kind {
+	case yamlv3.MappingNode:
+		return "a map"
+	case yamlv3.SequenceNode:
+		return "a list"
+	}
+	return fmt.Sprintf("%q", n.Value)
+}
+
+// suggest returns a hint naming the known key closest to
+// the unknown key, if any is close enough to be a typo.
+func suggest(name string, keys ...map[string]checkFunc) string {
+	var best string
+	var bestDist = 3
+	for _, known := range keys {
+		for key := range known {
+			d := distance(name, key)
+			if d < bestDist || (d == bestDist && key < best) {
+				best, bestDist = key, d
+			}
+		}
+	}
+	if len(best) == 0 || bestDist > 2 || bestDist >= len(name) {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %s?", best)
+}
+
+// distance returns the Levenshtein distance between two
+// strings.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(v ...int) int {
+	m := v[0]
+	for _, i := range v[1:] {
+		if i < m {
+			m = i
+		}
+	}
+	return m
+}
@@ -0,0 +1,129 @@
+package yaml
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestLint(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Lint Yaml", func() {
+
+		g.It("Should accept a valid Yaml", func() {
+			g.Assert(len(LintString(sample))).Equal(0)
+			g.Assert(len(LintString(variables))).Equal(1) // build_values anchor
+		})
+
+		g.It("Should report unknown keys with a suggestion", func() {
+			diags := LintString(lintTypos)
+			g.Assert(len(diags)).Equal(3)
+			g.Assert(diags[0].String()).Equal("4:3: error: unknown build key comands, did you mean commands?")
+			g.Assert(diags[1].String()).Equal("9:5: warning: unknown plugin key wehn is passed to the plugin as an argument, did you mean when?")
+			g.Assert(diags[2].String()).Equal("12:1: warning: unknown section notfy, did you mean notify?")
+		})
+
+		g.It("Should report unknown filter keys", func() {
+			diags := LintString(lintFilter)
+			g.Assert(len(diags)).Equal(1)
+			g.Assert(diags[0].String()).Equal("6:9: error: unknown when key brnch, did you mean branch?")
+		})
+
+		g.It("Should report wrong types", func() {
+			diags := LintString(lintTypes)
+			g.Assert(len(diags)).Equal(3)
+			g.Assert(diags[0].String()).Equal(`3:15: error: expected a boolean, found "maybe"`)
+			g.Assert(diags[1].String()).Equal(`4:13: error: expected a list, found "go test"`)
+			g.Assert(diags[2].String()).Equal(`7:5: error: expected a string, found a list`)
+		})
+
+		g.It("Should report empty images and unknown plugins", func() {
+			diags := LintString(lintImages)
+			g.Assert(len(diags)).Equal(2)
+			g.Assert(diags[0].String()).Equal(`4:12: error: image must not be empty`)
+			g.Assert(diags[1].String()).Equal(`6:3: warning: unknown plugin herokku`)
+		})
+
+		g.It("Should report invalid secret files", func() {
+			diags := LintString(lintSecrets)
+			g.Assert(len(diags)).Equal(4)
+			g.Assert(diags[0].String()).Equal(`6:15: error: secret target run/secrets/key must be an absolute path`)
+			g.Assert(diags[1].String()).Equal(`7:7: error: secret must specify a source`)
+			g.Assert(diags[2].String()).Equal(`8:7: error: unknown secret key sourc, did you mean source?`)
+			g.Assert(diags[3].String()).Equal(`8:7: error: secret must specify a source`)
+		})
+
+		g.It("Should lint top-level build keys", func() {
+			diags := LintString("version: 1\nimage: golang\nbuild:\n  image: golang\n  comands: []\n")
+			g.Assert(len(diags)).Equal(2)
+			g.Assert(diags[0].String()).Equal("2:1: warning: unknown section image")
+			g.Assert(diags[1].String()).Equal("5:3: error: unknown build key comands, did you mean commands?")
+		})
+
+		g.It("Should report unsupported versions", func() {
+			diags := LintString("version: 2\nbuild:\n  image: golang\n")
+			g.Assert(len(diags)).Equal(1)
+			g.Assert(diags[0].String()).Equal("1:10: error: unsupported version 2, expected a version between 1 and 1")
+		})
+
+		g.It("Should report syntax errors with a line", func() {
+			diags := LintString("build:\n  image: golang\n   commands: []\n")
+			g.Assert(len(diags)).Equal(1)
+			g.Assert(diags[0].Line).Equal(3)
+			g.Assert(diags[0].Severity).Equal(SeverityError)
+		})
+	})
+}
+
+var lintTypos = `
+build:
+  image: golang
+  comands:
+    - go test
+deploy:
+  heroku:
+    app: foo.com
+    wehn:
+      branch: master
+
+notfy:
+  slack: {}
+`
+
+var lintFilter = `
+deploy:
+  heroku:
+    app: foo.com
+    when:
+        brnch: master
+`
+
+var lintTypes = `
+build:
+  privileged: maybe
+  commands: go test
+  image: golang
+  net:
+    - host
+`
+
+var lintImages = `
+compose:
+  redis:
+    image: ""
+deploy:
+  herokku:
+    app: foo.com
+`
+
+var lintSecrets = `
+build:
+  image: golang
+  secrets:
+    - source: key
+      target: run/secrets/key
+    - target: /run/secrets/token
+    - sourc: token
+      target: /run/secrets/token
+`
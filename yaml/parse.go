@@ -2,9 +2,15 @@ package yaml
 
 import "gopkg.in/yaml.v2"
 
-// Parse parses a Yaml configuraiton file.
+// Parse parses a Yaml configuraiton file. Files using an
+// older version of the format are upgraded to the current
+// version before parsing.
 func Parse(in []byte) (*Config, error) {
 	c := Config{}
+	in, err := Migrate(in)
+	if err != nil {
+		return &c, err
+	}
 	e := yaml.Unmarshal(in, &c)
 	return &c, e
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/franela/goblin"
+	"gopkg.in/yaml.v2"
 )
 
 func TestParse(t *testing.T) {
@@ -83,6 +84,11 @@ func TestParse(t *testing.T) {
 			g.Assert(s[1].Image).Equal("heroku")
 		})
 
+		g.It("Should name steps after their keys", func() {
+			g.Assert(conf.Deploy.Slice()[0].Name).Equal("heroku")
+			g.Assert(conf.Compose.Slice()[1].Name).Equal("mongo")
+		})
+
 		g.It("Should maintain plugin ordering", func() {
 			s := conf.Deploy.Slice()
 			g.Assert(s[0].Vargs["app"]).Equal("foo.com")
@@ -96,6 +102,16 @@ func TestParse(t *testing.T) {
 			g.Assert(s[1].Filter.Matrix).Equal(map[string]string{"go_version": "1.5"})
 		})
 
+		g.It("Should parse build filters", func() {
+			g.Assert(conf.Build.Filter.Event.Slice()).Equal([]string{"push"})
+		})
+
+		g.It("Should parse compose filters", func() {
+			s := conf.Compose.Slice()
+			g.Assert(s[0].Filter.Branch.Len()).Equal(0)
+			g.Assert(s[1].Filter.Branch.Slice()).Equal([]string{"master"})
+		})
+
 		g.It("Should error when Yaml is malformed", func() {
 			_, err := ParseString(malformed)
 			g.Assert(err.Error()).Equal("yaml: found unexpected ':'")
@@ -113,6 +129,37 @@ func TestParse(t *testing.T) {
 			g.Assert(varConf.Build.Net).Equal("bridge")
 			g.Assert(varConf.Build.Privileged).Equal(true)
 		})
+
+		g.It("Should round-trip the configuration", func() {
+			for _, fixture := range []string{sample, variables, malformed} {
+				before, err := ParseString(fixture)
+				if err != nil {
+					continue // malformed fixtures have nothing to round-trip
+				}
+				out, err := yaml.Marshal(before)
+				g.Assert(err == nil).IsTrue()
+
+				after, err := Parse(out)
+				g.Assert(err == nil).IsTrue()
+				g.Assert(after).Equal(before)
+
+				// marshalling is deterministic
+				again, _ := yaml.Marshal(after)
+				g.Assert(string(again)).Equal(string(out))
+			}
+		})
+
+		g.It("Should preserve step names and ordering", func() {
+			out, _ := yaml.Marshal(conf)
+			after, _ := Parse(out)
+			deploy := after.Deploy.Slice()
+			g.Assert(len(deploy)).Equal(2)
+			g.Assert(deploy[0].Name).Equal("heroku")
+			g.Assert(deploy[0].Vargs["app"]).Equal("foo.com")
+			g.Assert(deploy[1].Vargs["app"]).Equal("dev.foo.com")
+			g.Assert(after.Compose.Slice()[0].Name).Equal("redis")
+			g.Assert(after.Compose.Slice()[1].Name).Equal("mongo")
+		})
 	})
 }
 
@@ -139,6 +186,8 @@ build:
     password: test
     username: test
     email: test@example.com
+  when:
+    event: push
 
 compose:
   redis:
@@ -150,6 +199,8 @@ compose:
     command:
       - --storageEngine
       - wiredTiger
+    when:
+      branch: master
 
 deploy:
   heroku:
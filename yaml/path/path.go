@@ -1,6 +1,7 @@
 package path
 
 import (
+	"errors"
 	"net/url"
 	"path/filepath"
 	"strings"
@@ -13,6 +14,14 @@ import (
 // directory or one of its childen.
 const DefaultRoot = "/drone/src"
 
+// default template of the workspace path, relative to
+// the root directory, when no clone path is provided.
+const DefaultTemplate = "{host}/{path}"
+
+// ErrInvalidPath is returned when the clone path is
+// outside of the root directory.
+var ErrInvalidPath = errors.New("clone path must be inside the workspace root")
+
 // config represents a simple Yaml config file with the clone
 // section and the path attribute. This is used to quickly
 // extract only the path.
@@ -25,9 +34,21 @@ type config struct {
 // Parse parses a yaml file to find the default
 // workspace path. If empty, the default uri is
 // used to determine the workspace.
-func Parse(raw, rawurl string) string {
+func Parse(raw, rawurl string) (string, error) {
+	return ParseRoot(raw, rawurl, DefaultRoot, DefaultTemplate)
+}
+
+// ParseRoot parses a yaml file to find the workspace path
+// inside the root directory. If empty, the path is derived
+// from the uri using the template, which may reference the
+// {host}, {path}, {owner} and {name} of the uri. The clone
+// path must be relative, or an absolute path inside the root.
+func ParseRoot(raw, rawurl, root, tmpl string) (string, error) {
 	data := config{}
-	path := FromUrl(rawurl)
+	if len(tmpl) == 0 {
+		tmpl = DefaultTemplate
+	}
+	path := strings.TrimPrefix(FromTemplate(rawurl, tmpl), "/")
 
 	// unarmshal into the temporary Yaml object
 	yaml.Unmarshal([]byte(raw), &data)
@@ -38,18 +59,41 @@ func Parse(raw, rawurl string) string {
 		path = data.Clone.Path
 	}
 
-	if filepath.HasPrefix(path, DefaultRoot) {
-		return path
+	root = filepath.Clean(root)
+	if filepath.IsAbs(path) {
+		path = filepath.Clean(path)
+		if !inside(root, path) {
+			return "", ErrInvalidPath
+		}
+		return path, nil
 	}
 
 	// otherwise return the clone path, joined with the
-	// root workspace. Note that this means the clone
-	// path must be a relative path.
-	return filepath.Join(DefaultRoot, path)
+	// root workspace. The path is rejected if it escapes
+	// the root, for example using ../
+	path = filepath.Join(root, path)
+	if !inside(root, path) {
+		return "", ErrInvalidPath
+	}
+	return path, nil
+}
+
+// inside returns true if the path is the root directory
+// or one of its children.
+func inside(root, path string) bool {
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/")
 }
 
 // FromUrl returns a workspace path from the url.
 func FromUrl(rawurl string) string {
+	return FromTemplate(rawurl, DefaultTemplate)
+}
+
+// FromTemplate returns a workspace path from the url using
+// the template. The {host} excludes the port, {path} is the
+// path of the url, and {owner} and {name} are the directory
+// and base name of the path.
+func FromTemplate(rawurl, tmpl string) string {
 	url_, err := url.Parse(rawurl)
 	if err != nil {
 		return string(filepath.Separator)
@@ -69,6 +113,15 @@ func FromUrl(rawurl string) string {
 	}
 
 	path = filepath.ToSlash(path) // just for windows
-	path = filepath.Clean(path)
-	return filepath.Join(host, path)
+	path = filepath.Clean("/" + path)
+	path = strings.TrimPrefix(path, "/")
+
+	owner, name := filepath.Split(path)
+	r := strings.NewReplacer(
+		"{host}", host,
+		"{path}", path,
+		"{owner}", strings.TrimSuffix(owner, "/"),
+		"{name}", name,
+	)
+	return filepath.Join("/", r.Replace(tmpl))[1:]
 }
@@ -12,34 +12,72 @@ func Test_Parse(t *testing.T) {
 	g.Describe("Parsing the yaml", func() {
 
 		g.It("Should return the clone path", func() {
-			p := Parse(sampleClone, "http://github.com/foo/bar")
+			p, _ := Parse(sampleClone, "http://github.com/foo/bar")
 			g.Assert(p).Equal("/drone/src/github.com/octocat/hello-world")
 		})
 
 		g.It("Should handle missing clone path", func() {
-			p := Parse(sampleEmpty, "http://github.com/foo/bar")
+			p, _ := Parse(sampleEmpty, "http://github.com/foo/bar")
 			g.Assert(p).Equal("/drone/src/github.com/foo/bar")
 		})
 
 		g.It("Should handle mission clone section", func() {
-			p := Parse(sampleMissing, "http://github.com/foo/bar")
+			p, _ := Parse(sampleMissing, "http://github.com/foo/bar")
 			g.Assert(p).Equal("/drone/src/github.com/foo/bar")
 		})
 
 		g.It("Should exclude port numbers from the url", func() {
-			p := Parse(sampleMissing, "http://github.com:80/foo/bar")
+			p, _ := Parse(sampleMissing, "http://github.com:80/foo/bar")
 			g.Assert(p).Equal("/drone/src/github.com/foo/bar")
 		})
 
 		g.It("Should not prepend root if already part of path", func() {
-			p := Parse(sampleAbs, "http://github.com/foo/bar")
+			p, _ := Parse(sampleAbs, "http://github.com/foo/bar")
 			g.Assert(p).Equal("/drone/src/github.com/octocat/hello-world")
 		})
 
 		g.It("Should use an empty path when the url is malformed", func() {
-			p := Parse(sampleMissing, "%gh&%ij")
+			p, _ := Parse(sampleMissing, "%gh&%ij")
 			g.Assert(p).Equal("/drone/src")
 		})
+
+		g.It("Should reject paths outside of the root", func() {
+			_, err := Parse(sampleTraversal, "http://github.com/foo/bar")
+			g.Assert(err).Equal(ErrInvalidPath)
+
+			_, err = Parse(sampleOutside, "http://github.com/foo/bar")
+			g.Assert(err).Equal(ErrInvalidPath)
+
+			_, err = Parse(samplePrefix, "http://github.com/foo/bar")
+			g.Assert(err).Equal(ErrInvalidPath)
+		})
+
+		g.It("Should normalize the clone path", func() {
+			p, err := Parse(sampleUnclean, "http://github.com/foo/bar")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(p).Equal("/drone/src/github.com/octocat/hello-world")
+		})
+
+		g.It("Should use a custom root and template", func() {
+			p, err := ParseRoot(sampleMissing, "http://github.com:80/foo/bar", "/go/src", "{host}/{owner}/{name}")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(p).Equal("/go/src/github.com/foo/bar")
+
+			p, _ = ParseRoot(sampleMissing, "https://gitlab.com/group/sub/bar", "/go/src/", "{name}")
+			g.Assert(p).Equal("/go/src/bar")
+
+			p, _ = ParseRoot(sampleMissing, "https://gitlab.com/group/sub/bar", "/go/src", "{owner}")
+			g.Assert(p).Equal("/go/src/group/sub")
+
+			p, _ = ParseRoot(sampleClone, "http://github.com/foo/bar", "/go/src", "")
+			g.Assert(p).Equal("/go/src/github.com/octocat/hello-world")
+		})
+
+		g.It("Should not escape the root using the template", func() {
+			p, err := ParseRoot(sampleMissing, "http://github.com/foo/bar", "/go/src", "../../{name}")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(p).Equal("/go/src/bar")
+		})
 	})
 }
 
@@ -60,3 +98,23 @@ var sampleAbs = `
 clone:
   path: /drone/src/github.com/octocat/hello-world
 `
+
+var sampleTraversal = `
+clone:
+  path: github.com/../../../etc
+`
+
+var sampleOutside = `
+clone:
+  path: /etc/octocat
+`
+
+var samplePrefix = `
+clone:
+  path: /drone/srcfoo/octocat
+`
+
+var sampleUnclean = `
+clone:
+  path: ./github.com//octocat/../octocat/hello-world/
+`
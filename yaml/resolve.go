@@ -0,0 +1,302 @@
+package yaml
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// stepSections lists the sections that contain a map of
+// named steps.
+var stepSections = []string{"compose", "publish", "deploy", "notify"}
+
+// Resolve expands the include and templates sections of a
+// Yaml configuration file. Included files are loaded from
+// the first directory in dirs that contains them, and are
+// merged before the including file. Steps that extend a
+// template are merged with the template, with the fields
+// of the step taking precedence.
+//
+// The configuration is returned unchanged if it does not
+// use includes or templates.
+func Resolve(in []byte, dirs []string) ([]byte, error) {
+	doc := yaml.MapSlice{}
+	err := yaml.Unmarshal(in, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if !usesTemplates(doc) {
+		return in, nil
+	}
+
+	r := &resolver{dirs: dirs}
+	doc, err = r.include(doc, nil)
+	if err != nil {
+		return nil, err
+	}
+	doc, err = r.extend(doc)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// ResolveString expands the include and templates sections
+// of a Yaml configuration file in string format.
+func ResolveString(in string, dirs []string) (string, error) {
+	out, err := Resolve([]byte(in), dirs)
+	return string(out), err
+}
+
+type resolver struct {
+	dirs []string
+}
+
+// include loads and merges the included files. The stack
+// holds the files being included, to detect cycles.
+func (r *resolver) include(doc yaml.MapSlice, stack []string) (yaml.MapSlice, error) {
+	var files []string
+	switch v := get(doc, "include").(type) {
+	case nil:
+		return doc, nil
+	case string:
+		files = []string{v}
+	case []interface{}:
+		for _, file := range v {
+			files = append(files, fmt.Sprint(file))
+		}
+	default:
+		return nil, fmt.Errorf("yaml: include must be a file name or a list of file names")
+	}
+	doc = remove(doc, "include")
+
+	var base yaml.MapSlice
+	for _, file := range files {
+		path, err := r.find(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range stack {
+			if parent == path {
+				return nil, fmt.Errorf("yaml: include cycle %s -> %s", strings.Join(stack, " -> "), path)
+			}
+		}
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		included := yaml.MapSlice{}
+		err = yaml.Unmarshal(raw, &included)
+		if err != nil {
+			return nil, fmt.Errorf("yaml: parsing include %s: %s", file, err)
+		}
+		included, err = r.include(included, append(stack[:len(stack):len(stack)], path))
+		if err != nil {
+			return nil, err
+		}
+		base = mergeDoc(base, included)
+	}
+	return mergeDoc(base, doc), nil
+}
+
+// find returns the path of the included file in the first
+// directory that contains it. The file name must be relative
+// and may not reference a parent directory.
+func (r *resolver) find(file string) (string, error) {
+	clean := filepath.Clean(file)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("yaml: include %s must be a relative path inside the include directory", file)
+	}
+	for _, dir := range r.dirs {
+		if len(dir) == 0 {
+			continue
+		}
+		path := filepath.Join(dir, clean)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("yaml: include %s not found in %v", file, r.dirs)
+}
+
+// extend merges each step that extends a template with the
+// template, and removes the templates section.
+func (r *resolver) extend(doc yaml.MapSlice) (yaml.MapSlice, error) {
+	templates, _ := get(doc, "templates").(yaml.MapSlice)
+	doc = remove(doc, "templates")
+
+	for i, item := range doc {
+		key := fmt.Sprint(item.Key)
+		switch key {
+		case "build", "clone", "cache":
+			step, err := r.extendStep(key, item.Value, templates)
+			if err != nil {
+				return nil, err
+			}
+			doc[i].Value = step
+		default:
+			steps, ok := item.Value.(yaml.MapSlice)
+			if !ok || !isStepSection(key) {
+				continue
+			}
+			for j, step := range steps {
+				name := fmt.Sprintf("%s.%v", key, step.Key)
+				value, err := r.extendStep(name, step.Value, templates)
+				if err != nil {
+					return nil, err
+				}
+				steps[j].Value = value
+			}
+		}
+	}
+	return doc, nil
+}
+
+// extendStep merges the step with the template it extends,
+// following templates that extend other templates.
+func (r *resolver) extendStep(name string, value interface{}, templates yaml.MapSlice) (interface{}, error) {
+	step, ok := value.(yaml.MapSlice)
+	if !ok {
+		return value, nil
+	}
+	var chain []string
+	for {
+		parent, ok := get(step, "extends").(string)
+		if !ok {
+			return step, nil
+		}
+		for _, seen := range chain {
+			if seen == parent {
+				return nil, fmt.Errorf("yaml: template cycle %s -> %s", strings.Join(chain, " -> "), parent)
+			}
+		}
+		chain = append(chain, parent)
+
+		tmpl, ok := lookupTemplate(templates, parent)
+		if !ok {
+			return nil, fmt.Errorf("yaml: step %s extends unknown template %s", name, parent)
+		}
+		step = mergeMap(tmpl, remove(step, "extends"))
+	}
+}
+
+// lookupTemplate returns the named template. When a template
+// is defined more than once the last definition is used.
+func lookupTemplate(templates yaml.MapSlice, name string) (yaml.MapSlice, bool) {
+	var found yaml.MapSlice
+	var ok bool
+	for _, item := range templates {
+		if fmt.Sprint(item.Key) == name {
+			found, ok = item.Value.(yaml.MapSlice)
+		}
+	}
+	return found, ok
+}
+
+// mergeDoc merges two configuration files. Steps and
+// templates are concatenated, while other sections are
+// merged with the values in over taking precedence.
+func mergeDoc(base, over yaml.MapSlice) yaml.MapSlice {
+	out := append(yaml.MapSlice{}, base...)
+	for _, item := range over {
+		key := fmt.Sprint(item.Key)
+		i := index(out, key)
+		if i < 0 {
+			out = append(out, item)
+			continue
+		}
+		prev, ok1 := out[i].Value.(yaml.MapSlice)
+		next, ok2 := item.Value.(yaml.MapSlice)
+		switch {
+		case ok1 && ok2 && (key == "templates" || isStepSection(key)):
+			out[i].Value = append(append(yaml.MapSlice{}, prev...), next...)
+		case ok1 && ok2:
+			out[i].Value = mergeMap(prev, next)
+		default:
+			out[i].Value = item.Value
+		}
+	}
+	return out
+}
+
+// mergeMap deeply merges two maps, with the values in over
+// taking precedence. Lists and scalar values are replaced.
+func mergeMap(base, over yaml.MapSlice) yaml.MapSlice {
+	out := append(yaml.MapSlice{}, base...)
+	for _, item := range over {
+		i := index(out, fmt.Sprint(item.Key))
+		if i < 0 {
+			out = append(out, item)
+			continue
+		}
+		prev, ok1 := out[i].Value.(yaml.MapSlice)
+		next, ok2 := item.Value.(yaml.MapSlice)
+		if ok1 && ok2 {
+			out[i].Value = mergeMap(prev, next)
+		} else {
+			out[i].Value = item.Value
+		}
+	}
+	return out
+}
+
+// usesTemplates returns true if the configuration includes
+// files, or a step extends a template.
+func usesTemplates(doc yaml.MapSlice) bool {
+	if index(doc, "include") >= 0 || index(doc, "templates") >= 0 {
+		return true
+	}
+	for _, key := range []string{"build", "clone", "cache"} {
+		if step, ok := get(doc, key).(yaml.MapSlice); ok && index(step, "extends") >= 0 {
+			return true
+		}
+	}
+	for _, key := range stepSections {
+		steps, _ := get(doc, key).(yaml.MapSlice)
+		for _, item := range steps {
+			if step, ok := item.Value.(yaml.MapSlice); ok && index(step, "extends") >= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isStepSection(key string) bool {
+	for _, section := range stepSections {
+		if section == key {
+			return true
+		}
+	}
+	return false
+}
+
+func index(m yaml.MapSlice, key string) int {
+	for i, item := range m {
+		if fmt.Sprint(item.Key) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func get(m yaml.MapSlice, key string) interface{} {
+	if i := index(m, key); i >= 0 {
+		return m[i].Value
+	}
+	return nil
+}
+
+func remove(m yaml.MapSlice, key string) yaml.MapSlice {
+	out := yaml.MapSlice{}
+	for _, item := range m {
+		if fmt.Sprint(item.Key) != key {
+			out = append(out, item)
+		}
+	}
+	return out
+}
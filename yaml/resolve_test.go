@@ -0,0 +1,175 @@
+package yaml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestResolve(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Resolve Yaml templates", func() {
+
+		var dir string
+
+		g.Before(func() {
+			dir, _ = ioutil.TempDir("", "drone-exec")
+			ioutil.WriteFile(filepath.Join(dir, "base.yml"), []byte(includeBase), 0600)
+			ioutil.WriteFile(filepath.Join(dir, "a.yml"), []byte("include: b.yml\n"), 0600)
+			ioutil.WriteFile(filepath.Join(dir, "b.yml"), []byte("include: a.yml\n"), 0600)
+		})
+
+		g.After(func() {
+			os.RemoveAll(dir)
+		})
+
+		g.It("Should return the Yaml unchanged without templates", func() {
+			out, err := ResolveString(sample, nil)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(out).Equal(sample)
+		})
+
+		g.It("Should merge steps with their template", func() {
+			out, err := ResolveString(templateSample, nil)
+			g.Assert(err == nil).IsTrue()
+
+			conf, err := ParseString(out)
+			g.Assert(err == nil).IsTrue()
+			deploy := conf.Deploy.Slice()
+			g.Assert(len(deploy)).Equal(2)
+			g.Assert(deploy[0].Image).Equal("plugins/heroku")
+			g.Assert(deploy[0].Vargs["app"]).Equal("staging")
+			g.Assert(deploy[0].Vargs["force"]).Equal(true)
+			g.Assert(deploy[0].Filter.Branch.Slice()).Equal([]string{"develop"})
+			g.Assert(deploy[1].Vargs["app"]).Equal("production")
+			g.Assert(deploy[1].Filter.Branch.Slice()).Equal([]string{"master"})
+		})
+
+		g.It("Should follow templates that extend templates", func() {
+			out, err := ResolveString(templateChain, nil)
+			g.Assert(err == nil).IsTrue()
+
+			conf, err := ParseString(out)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Build.Image).Equal("golang:1.5")
+			g.Assert(conf.Build.Commands).Equal([]string{"go test"})
+			g.Assert(conf.Build.Privileged).Equal(true)
+		})
+
+		g.It("Should reject template cycles", func() {
+			_, err := ResolveString(templateCycle, nil)
+			g.Assert(err.Error()).Equal("yaml: template cycle a -> b -> a")
+		})
+
+		g.It("Should reject unknown templates", func() {
+			_, err := ResolveString("deploy:\n  heroku:\n    extends: herok\n", nil)
+			g.Assert(err.Error()).Equal("yaml: step deploy.heroku extends unknown template herok")
+		})
+
+		g.It("Should merge included files", func() {
+			out, err := ResolveString(includeSample, []string{"", dir})
+			g.Assert(err == nil).IsTrue()
+
+			conf, err := ParseString(out)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Build.Image).Equal("golang:1.5")
+			g.Assert(conf.Build.Commands).Equal([]string{"go build"})
+			g.Assert(len(conf.Notify.Slice())).Equal(2)
+			g.Assert(conf.Notify.Slice()[0].Name).Equal("slack")
+			g.Assert(conf.Notify.Slice()[1].Name).Equal("email")
+			g.Assert(conf.Notify.Slice()[1].Vargs["recipients"]).Equal([]interface{}{"ops@example.com"})
+		})
+
+		g.It("Should reject include cycles", func() {
+			_, err := ResolveString("include: a.yml\n", []string{dir})
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("Should reject includes outside the include directory", func() {
+			_, err := ResolveString("include: ../etc/passwd\n", []string{dir})
+			g.Assert(err.Error()).Equal("yaml: include ../etc/passwd must be a relative path inside the include directory")
+
+			_, err = ResolveString("include: /etc/passwd\n", []string{dir})
+			g.Assert(err == nil).IsFalse()
+		})
+
+		g.It("Should reject missing includes", func() {
+			_, err := ResolveString("include: missing.yml\n", []string{dir})
+			g.Assert(err == nil).IsFalse()
+		})
+	})
+}
+
+var templateSample = `
+templates:
+  heroku:
+    image: plugins/heroku
+    force: true
+    when:
+      branch: master
+
+deploy:
+  staging:
+    extends: heroku
+    app: staging
+    when:
+      branch: develop
+  production:
+    extends: heroku
+    app: production
+`
+
+var templateChain = `
+templates:
+  golang:
+    image: golang:1.5
+    commands:
+      - go build
+  test:
+    extends: golang
+    commands:
+      - go test
+
+build:
+  extends: test
+  privileged: true
+`
+
+var templateCycle = `
+templates:
+  a:
+    extends: b
+  b:
+    extends: a
+
+build:
+  extends: a
+`
+
+var includeBase = `
+build:
+  image: golang:1.5
+  commands:
+    - go test
+
+notify:
+  slack:
+    channel: dev
+`
+
+var includeSample = `
+include: base.yml
+
+build:
+  commands:
+    - go build
+
+notify:
+  email:
+    recipients:
+      - ops@example.com
+`
@@ -0,0 +1,164 @@
+package yaml
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// schemaURI identifies the JSON Schema draft used by the
+// generated schema.
+const schemaURI = "http://json-schema.org/draft-07/schema#"
+
+// object is a JSON Schema object.
+type object map[string]interface{}
+
+// schemaTypes defines the schema of the types with custom
+// Yaml unmarshal functions, which accept more than one form.
+var schemaTypes = map[reflect.Type]object{
+	reflect.TypeOf(Command{}): {
+		"description": "A command string, split using shell quoting rules, or a list of arguments.",
+		"oneOf": []object{
+			{"type": "string"},
+			{"type": "array", "items": object{"type": "string"}},
+		},
+	},
+	reflect.TypeOf(Stringorslice{}): {
+		"oneOf": []object{
+			{"type": "string"},
+			{"type": "array", "items": object{"type": "string"}},
+		},
+	},
+	reflect.TypeOf(MapEqualSlice{}): {
+		"description": "A list of KEY=VALUE strings, or a map of keys to values.",
+		"oneOf": []object{
+			{"type": "array", "items": object{"type": "string"}},
+			{"type": "object", "additionalProperties": object{"type": "string"}},
+		},
+	},
+}
+
+// schemaSlices defines the element type of the slices of
+// named steps, which are decoded from a map.
+var schemaSlices = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(Containerslice{}): reflect.TypeOf(Container{}),
+	reflect.TypeOf(Pluginslice{}):    reflect.TypeOf(Plugin{}),
+}
+
+// schemaExtra defines keys that are not fields of the Go
+// types, since they are handled before the configuration
+// is decoded.
+var schemaExtra = map[string]map[string]object{
+	"Config": {
+		"debug":   {"type": "boolean"},
+		"version": {"type": "integer", "minimum": 1, "maximum": Version},
+		"include": ref("Stringorslice"),
+		"templates": {
+			"type":                 "object",
+			"additionalProperties": object{"type": "object"},
+		},
+	},
+	"Container": {
+		"extends": {"type": "string"},
+	},
+}
+
+// Schema returns the JSON Schema of the Yaml configuration
+// file, generated from the Config type and the types it
+// references.
+func Schema() ([]byte, error) {
+	g := &schemaGen{defs: object{}}
+	root := g.structSchema(reflect.TypeOf(Config{}))
+
+	// unknown top-level sections are allowed, since they
+	// are commonly used to declare Yaml anchors.
+	root["additionalProperties"] = true
+	root["$schema"] = schemaURI
+	root["title"] = "drone-exec configuration"
+	root["definitions"] = g.defs
+	return json.MarshalIndent(root, "", "  ")
+}
+
+type schemaGen struct {
+	defs object
+}
+
+// typeSchema returns the schema of the type, adding structs
+// and custom types to the definitions.
+func (g *schemaGen) typeSchema(t reflect.Type) object {
+	if s, ok := schemaTypes[t]; ok {
+		g.defs[t.Name()] = s
+		return ref(t.Name())
+	}
+	if elem, ok := schemaSlices[t]; ok {
+		return object{"type": "object", "additionalProperties": g.typeSchema(elem)}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = object{} // placeholder for recursive types
+			g.defs[t.Name()] = g.structSchema(t)
+		}
+		return ref(t.Name())
+	case reflect.Slice:
+		return object{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return object{"type": "integer"}
+	case reflect.Interface:
+		return object{}
+	}
+	return object{"type": "string"}
+}
+
+// structSchema returns the schema of a struct. Inline fields
+// are flattened into the struct, and an inline map allows
+// any additional property.
+func (g *schemaGen) structSchema(t reflect.Type) object {
+	props := object{}
+	additional := false
+	g.addFields(t, props, &additional)
+	return object{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": additional,
+	}
+}
+
+func (g *schemaGen) addFields(t reflect.Type, props object, additional *bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, inline := yamlName(field)
+		switch {
+		case name == "-":
+			continue
+		case inline && field.Type.Kind() == reflect.Map:
+			*additional = true
+		case inline:
+			g.addFields(field.Type, props, additional)
+		default:
+			props[name] = g.typeSchema(field.Type)
+		}
+	}
+	for name, s := range schemaExtra[t.Name()] {
+		props[name] = s
+	}
+}
+
+// yamlName returns the Yaml key of the struct field, using
+// the same rules as the Yaml decoder.
+func yamlName(field reflect.StructField) (string, bool) {
+	parts := strings.Split(field.Tag.Get("yaml"), ",")
+	inline := len(parts) > 1 && parts[1] == "inline"
+	if len(parts[0]) != 0 {
+		return parts[0], inline
+	}
+	return strings.ToLower(field.Name), inline
+}
+
+func ref(name string) object {
+	return object{"$ref": "#/definitions/" + name}
+}
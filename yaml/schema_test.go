@@ -0,0 +1,75 @@
+package yaml
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestSchema(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Yaml schema", func() {
+
+		var schema struct {
+			Properties  map[string]interface{}
+			Definitions map[string]struct {
+				Properties map[string]interface{}
+			}
+		}
+
+		g.Before(func() {
+			out, _ := Schema()
+			json.Unmarshal(out, &schema)
+		})
+
+		g.It("Should match the schema.json file", func() {
+			out, err := Schema()
+			g.Assert(err == nil).IsTrue()
+
+			// regenerate with drone-exec schema > yaml/schema.json
+			file, err := ioutil.ReadFile("schema.json")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(string(out) + "\n").Equal(string(file))
+		})
+
+		g.It("Should define the keys known to the linter", func() {
+			g.Assert(keys(schema.Properties)).Equal(tableKeys(configKeys))
+			g.Assert(keys(schema.Definitions["Container"].Properties)).Equal(tableKeys(containerKeys))
+			g.Assert(keys(schema.Definitions["Build"].Properties)).Equal(tableKeys(containerKeys, buildKeys))
+			g.Assert(keys(schema.Definitions["Plugin"].Properties)).Equal(tableKeys(containerKeys))
+			g.Assert(keys(schema.Definitions["Filter"].Properties)).Equal(tableKeys(filterKeys))
+			g.Assert(keys(schema.Definitions["AuthConfig"].Properties)).Equal(tableKeys(authConfigKeys))
+		})
+
+		g.It("Should define the polymorphic types", func() {
+			for _, name := range []string{"Command", "Stringorslice", "MapEqualSlice"} {
+				_, ok := schema.Definitions[name]
+				g.Assert(ok).IsTrue()
+			}
+		})
+	})
+}
+
+func keys(m map[string]interface{}) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func tableKeys(tables ...map[string]checkFunc) []string {
+	var out []string
+	for _, table := range tables {
+		for k := range table {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,155 @@
+package secure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SecretProvider provides the secure section of a repository,
+// identified by its full name.
+type SecretProvider interface {
+	Secrets(repo string) (*Secure, error)
+}
+
+// NewEncryptedProvider returns a SecretProvider that decrypts
+// the encrypted secure section with the PEM encoded private keys.
+func NewEncryptedProvider(in, privKey string) SecretProvider {
+	return &encryptedProvider{in, privKey}
+}
+
+type encryptedProvider struct {
+	in      string
+	privKey string
+}
+
+func (p *encryptedProvider) Secrets(repo string) (*Secure, error) {
+	return Parse(p.in, p.privKey)
+}
+
+// NewFileProvider returns a SecretProvider that reads a plaintext
+// secure section from a Yaml file, or the secrets from a directory
+// with one file per secret, such as a mounted secret volume. The
+// checksum of the Yaml file is read from the .checksum file of the
+// directory.
+func NewFileProvider(path string) SecretProvider {
+	return &fileProvider{path}
+}
+
+// checksumFile is the file of a secrets directory that holds the
+// checksum of the Yaml file.
+const checksumFile = ".checksum"
+
+type fileProvider struct {
+	path string
+}
+
+func (p *fileProvider) Secrets(repo string) (*Secure, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		raw, err := ioutil.ReadFile(p.path)
+		if err != nil {
+			return nil, err
+		}
+		out := &Secure{}
+		err = yaml.Unmarshal(raw, out)
+		return out, err
+	}
+
+	files, err := ioutil.ReadDir(p.path)
+	if err != nil {
+		return nil, err
+	}
+	out := &Secure{}
+	out.Environment.parts = map[string]string{}
+	out.Environment.secrets = map[string]*Secret{}
+	for _, file := range files {
+		// hidden files, such as the ..data links of a
+		// Kubernetes secret volume, are skipped.
+		name := file.Name()
+		path := filepath.Join(p.path, name)
+		if name == checksumFile {
+			raw, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			out.Checksum = strings.TrimSpace(string(raw))
+			continue
+		}
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		value := strings.TrimRight(string(raw), "\r\n")
+		out.Environment.parts[name] = value
+		out.Environment.secrets[name] = &Secret{Value: value}
+	}
+	return out, nil
+}
+
+// NewHTTPProvider returns a SecretProvider that fetches the
+// plaintext secure section of the repository from the endpoint,
+// at {endpoint}/repos/{owner}/{name}/secrets, authenticated with
+// the bearer token. The response is a Yaml or JSON document.
+func NewHTTPProvider(endpoint, token string) SecretProvider {
+	return &httpProvider{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		token:    token,
+		client:   &http.Client{Timeout: time.Minute},
+	}
+}
+
+type httpProvider struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+func (p *httpProvider) Secrets(repo string) (*Secure, error) {
+	url := fmt.Sprintf("%s/repos/%s/secrets", p.endpoint, repo)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil // no secrets for the repository
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("secure: fetching secrets: %s", resp.Status)
+	}
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	out := &Secure{}
+	err = yaml.Unmarshal(raw, out)
+	return out, err
+}
@@ -0,0 +1,95 @@
+package secure
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func Test_Provider(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Secret providers", func() {
+
+		g.It("Should decrypt the encrypted secrets", func() {
+			secure, err := NewEncryptedProvider(mapEnc, fakePriv).Secrets("octocat/hello-world")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(secure.Environment.Map()["FOO"]).Equal("Bar")
+		})
+
+		g.It("Should read secrets from a Yaml file", func() {
+			dir, _ := ioutil.TempDir("", "secrets")
+			defer os.RemoveAll(dir)
+			file := filepath.Join(dir, "secrets.yml")
+			ioutil.WriteFile(file, []byte(mapYaml), 0600)
+
+			secure, err := NewFileProvider(file).Secrets("octocat/hello-world")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(secure.Checksum).Equal("fa4d4048a6bd1a94f2775039ecf29b812d9cfe6b")
+			g.Assert(secure.Environment.Map()["FOO"]).Equal("BAR")
+		})
+
+		g.It("Should read secrets from a directory", func() {
+			dir, _ := ioutil.TempDir("", "secrets")
+			defer os.RemoveAll(dir)
+			ioutil.WriteFile(filepath.Join(dir, "FOO"), []byte("BAR\n"), 0600)
+			ioutil.WriteFile(filepath.Join(dir, "BAZ"), []byte("BOO"), 0600)
+			ioutil.WriteFile(filepath.Join(dir, ".hidden"), []byte("QUX"), 0600)
+			os.Mkdir(filepath.Join(dir, "nested"), 0700)
+
+			secure, err := NewFileProvider(dir).Secrets("octocat/hello-world")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(secure.Checksum).Equal("")
+			g.Assert(secure.Environment.Map()).Equal(map[string]string{"FOO": "BAR", "BAZ": "BOO"})
+			g.Assert(secure.Environment.Secrets()["FOO"].Value).Equal("BAR")
+		})
+
+		g.It("Should read the checksum from a directory", func() {
+			dir, _ := ioutil.TempDir("", "secrets")
+			defer os.RemoveAll(dir)
+			ioutil.WriteFile(filepath.Join(dir, "FOO"), []byte("BAR"), 0600)
+			ioutil.WriteFile(filepath.Join(dir, ".checksum"), []byte("sha256:1234\n"), 0600)
+
+			secure, err := NewFileProvider(dir).Secrets("octocat/hello-world")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(secure.Checksum).Equal("sha256:1234")
+			g.Assert(secure.Environment.Map()).Equal(map[string]string{"FOO": "BAR"})
+		})
+
+		g.It("Should return an error for a missing file", func() {
+			_, err := NewFileProvider("/does/not/exist").Secrets("octocat/hello-world")
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("Should fetch secrets over http", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Header.Get("Authorization") != "Bearer token":
+					w.WriteHeader(http.StatusUnauthorized)
+				case r.URL.Path == "/repos/octocat/hello-world/secrets":
+					w.Write([]byte(`{"checksum": "fa4d4048a6bd1a94f2775039ecf29b812d9cfe6b", "environment": {"FOO": "BAR"}}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			secure, err := NewHTTPProvider(server.URL+"/", "token").Secrets("octocat/hello-world")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(secure.Checksum).Equal("fa4d4048a6bd1a94f2775039ecf29b812d9cfe6b")
+			g.Assert(secure.Environment.Map()["FOO"]).Equal("BAR")
+
+			secure, err = NewHTTPProvider(server.URL, "token").Secrets("octocat/other")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(secure == nil).IsTrue()
+
+			_, err = NewHTTPProvider(server.URL, "invalid").Secrets("octocat/hello-world")
+			g.Assert(err != nil).IsTrue()
+		})
+	})
+}
@@ -1,30 +1,58 @@
 package secure
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
+	"fmt"
 
 	"github.com/square/go-jose"
 	"gopkg.in/yaml.v2"
 )
 
+var (
+	// ErrNoKey is returned when no PEM encoded private key
+	// is found.
+	ErrNoKey = errors.New("secure: no PEM encoded private key")
+
+	// ErrNoPublicKey is returned when no PEM encoded public
+	// key is found.
+	ErrNoPublicKey = errors.New("secure: no PEM encoded public key")
+
+	// ErrDecrypt is matched by the error returned when none of
+	// the private keys can decrypt the secrets.
+	ErrDecrypt = errors.New("secure: unable to decrypt secrets with the private keys")
+)
+
+// DecryptError is returned when none of the private keys can
+// decrypt the secrets. It wraps the error of the last key.
+type DecryptError struct {
+	Err error
+}
+
+func (e *DecryptError) Error() string { return fmt.Sprintf("%s: %s", ErrDecrypt, e.Err) }
+
+// Unwrap returns the error of the last key.
+func (e *DecryptError) Unwrap() error { return e.Err }
+
+// Is returns true if the target is ErrDecrypt.
+func (e *DecryptError) Is(target error) bool { return target == ErrDecrypt }
+
 type Secure struct {
 	Checksum    string        `yaml:"checksum"`
 	Environment MapEqualSlice `yaml:"environment"`
 }
 
 // Parse parses and returns the secure section of the
-// yaml file as plaintext parameters.
+// yaml file as plaintext parameters. The private key may
+// contain more than one PEM encoded key, which are tried
+// in order to support key rotation.
 func Parse(in, privKey string) (*Secure, error) {
-	// unarmshal the private key from PEM
-	rsaPrivKey, err := decodePrivateKey(privKey)
-	if err != nil {
-		return nil, err
-	}
-
 	// decrypt the Yaml file
-	plain, err := decrypt(in, rsaPrivKey)
+	plain, err := Decrypt(in, privKey)
 	if err != nil {
 		return nil, err
 	}
@@ -35,21 +63,125 @@ func Parse(in, privKey string) (*Secure, error) {
 	return out, err
 }
 
-// decrypt decrypts a JOSE string and returns the
-// plaintext value.
-func decrypt(secret string, privKey *rsa.PrivateKey) ([]byte, error) {
-	object, err := jose.ParseEncrypted(secret)
+// Decrypt decrypts the secure section of the yaml file with
+// the PEM encoded private keys, and returns the plaintext Yaml.
+func Decrypt(in, privKey string) ([]byte, error) {
+	keys, err := decodePrivateKeys(privKey)
 	if err != nil {
 		return nil, err
 	}
-	return object.Decrypt(privKey)
+	return decryptAny(in, keys)
+}
+
+// Encrypt marshals the secure section of the yaml file and
+// encrypts it with the PEM encoded public key.
+func Encrypt(sec *Secure, pubKey string) (string, error) {
+	key, err := decodePublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := yaml.Marshal(sec)
+	if err != nil {
+		return "", err
+	}
+	return encrypt(string(plain), key)
+}
+
+// decryptAny decrypts a JOSE string with the first private
+// key that succeeds, and returns the plaintext value.
+func decryptAny(secret string, privKeys []interface{}) ([]byte, error) {
+	object, err := jose.ParseEncrypted(secret)
+	if err != nil {
+		return nil, fmt.Errorf("secure: invalid encrypted secrets: %s", err)
+	}
+	for _, key := range privKeys {
+		var plain []byte
+		plain, err = object.Decrypt(key)
+		if err == nil {
+			return plain, nil
+		}
+	}
+	return nil, &DecryptError{Err: err}
+}
+
+// decodePrivateKeys is a helper function that unmarshals all
+// PEM blocks to RSA or EC Private Keys.
+func decodePrivateKeys(privateKey string) ([]interface{}, error) {
+	var keys []interface{}
+	rest := []byte(privateKey)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		key, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoKey
+	}
+	return keys, nil
+}
+
+// parsePrivateKey parses a PKCS#1 RSA, SEC 1 EC or PKCS#8
+// private key. EC keys must use the P-256 or P-384 curve.
+func parsePrivateKey(block *pem.Block) (interface{}, error) {
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("secure: unsupported private key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secure: invalid private key: %s", err)
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		if !supportedCurve(key.Curve) {
+			return nil, fmt.Errorf("secure: unsupported curve %s", key.Curve.Params().Name)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("secure: unsupported private key %T", key)
 }
 
-// decodePrivateKey is a helper function that unmarshals a PEM
-// bytes to an RSA Private Key
-func decodePrivateKey(privateKey string) (*rsa.PrivateKey, error) {
-	derBlock, _ := pem.Decode([]byte(privateKey))
-	return x509.ParsePKCS1PrivateKey(derBlock.Bytes)
+// decodePublicKey is a helper function that unmarshals a PEM
+// block to an RSA or EC Public Key.
+func decodePublicKey(publicKey string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return nil, ErrNoPublicKey
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("secure: unsupported public key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secure: invalid public key: %s", err)
+	}
+	return key, nil
+}
+
+func supportedCurve(curve elliptic.Curve) bool {
+	return curve == elliptic.P256() || curve == elliptic.P384()
 }
 
 // encodePrivateKey is a helper function that marshals an RSA
@@ -60,14 +192,28 @@ func encodePrivateKey(privkey *rsa.PrivateKey) string {
 	return string(privateKeyPEM)
 }
 
-// encrypt encrypts a plaintext variable using JOSE with
-// RSA_OAEP and A128GCM algorithms.
-func encrypt(text string, pubKey *rsa.PublicKey) (string, error) {
+// encrypt encrypts a plaintext variable using JOSE with the
+// RSA-OAEP-256 or ECDH-ES algorithm, depending on the public
+// key, and A256GCM.
+func encrypt(text string, pubKey interface{}) (string, error) {
 	var encrypted string
 	var plaintext = []byte(text)
 
-	// Creates a new encrypter using defaults
-	encrypter, err := jose.NewEncrypter(jose.RSA_OAEP, jose.A128GCM, pubKey)
+	var alg jose.KeyAlgorithm
+	switch key := pubKey.(type) {
+	case *rsa.PublicKey:
+		alg = jose.RSA_OAEP_256
+	case *ecdsa.PublicKey:
+		if !supportedCurve(key.Curve) {
+			return encrypted, fmt.Errorf("secure: unsupported curve %s", key.Curve.Params().Name)
+		}
+		alg = jose.ECDH_ES
+	default:
+		return encrypted, fmt.Errorf("secure: unsupported public key %T", pubKey)
+	}
+
+	// Creates a new encrypter for the key algorithm
+	encrypter, err := jose.NewEncrypter(alg, jose.A256GCM, pubKey)
 	if err != nil {
 		return encrypted, err
 	}
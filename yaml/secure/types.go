@@ -1,17 +1,120 @@
 package secure
 
-import "strings"
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Secret is a secret value, with optional restrictions on the
+// images of the steps, and the build events and branches, it
+// may be injected into. A secret without restrictions may be
+// injected anywhere.
+type Secret struct {
+	Value    string   `yaml:"value"`
+	Images   []string `yaml:"images,omitempty"`
+	Events   []string `yaml:"events,omitempty"`
+	Branches []string `yaml:"branches,omitempty"`
+}
+
+// UnmarshalYAML implements the Unmarshaller interface. A secret
+// is either a plain value or a map with restrictions.
+func (s *Secret) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	err := unmarshal(&s.Value)
+	if err == nil {
+		return nil
+	}
+	type secret Secret // avoids recursion
+	return unmarshal((*secret)(s))
+}
+
+// MarshalYAML implements the Marshaller interface. A secret
+// without restrictions is written as a plain value.
+func (s Secret) MarshalYAML() (interface{}, error) {
+	if !s.Scoped() {
+		return s.Value, nil
+	}
+	type secret Secret // avoids recursion
+	return secret(s), nil
+}
+
+// Scoped returns true if the secret may only be injected
+// into some steps or builds.
+func (s *Secret) Scoped() bool {
+	return len(s.Images) != 0 || len(s.Events) != 0 || len(s.Branches) != 0
+}
+
+// MatchBuild returns true if the secret may be injected into
+// a build with the given event and branch. Branches are
+// matched using glob patterns.
+func (s *Secret) MatchBuild(event, branch string) bool {
+	return matchAny(s.Events, event, false) && matchAny(s.Branches, branch, false)
+}
+
+// MatchImage returns true if the secret may be injected into
+// a step using the given image. Images are matched using glob
+// patterns, with or without the tag. Plugin aliases, such as
+// heroku, match the plugins/drone-heroku image.
+func (s *Secret) MatchImage(image string) bool {
+	return matchAny(s.Images, image, true)
+}
+
+func matchAny(patterns []string, value string, image bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	candidates := []string{value}
+	if image {
+		candidates = imageNames(value)
+	}
+	for _, pattern := range patterns {
+		if image {
+			pattern = expandImage(pattern)
+		}
+		for _, candidate := range candidates {
+			if ok, _ := filepath.Match(pattern, candidate); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// imageNames returns the expanded image name, with and
+// without the tag.
+func imageNames(image string) []string {
+	image = expandImage(image)
+	names := []string{image}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		names = append(names, image[:i])
+	}
+	return names
+}
+
+// expandImage expands a plugin alias to the fully qualified
+// image name, as done by the parser.
+func expandImage(image string) string {
+	if !strings.Contains(image, "/") {
+		image = "plugins/drone-" + image
+	}
+	return strings.Replace(image, "_", "-", -1)
+}
 
 type MapEqualSlice struct {
-	parts map[string]string
+	parts   map[string]string
+	secrets map[string]*Secret
 }
 
 func (s *MapEqualSlice) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	s.parts = map[string]string{}
-	err := unmarshal(&s.parts)
+	s.secrets = map[string]*Secret{}
+	err := unmarshal(&s.secrets)
 	if err == nil {
+		for k, v := range s.secrets {
+			s.parts[k] = v.Value
+		}
 		return nil
 	}
+	s.secrets = map[string]*Secret{}
 
 	var sliceType []string
 
@@ -26,16 +129,28 @@ func (s *MapEqualSlice) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			key := parts[0]
 			val := parts[1]
 			s.parts[key] = val
+			s.secrets[key] = &Secret{Value: val}
 		}
 	}
 
 	return nil
 }
 
+// Map returns the secret values, including scoped secrets.
 func (s *MapEqualSlice) Map() map[string]string {
 	return s.parts
 }
 
+// Secrets returns the secrets and their restrictions.
+func (s *MapEqualSlice) Secrets() map[string]*Secret {
+	return s.secrets
+}
+
 func (s MapEqualSlice) MarshalYAML() (interface{}, error) {
+	for _, secret := range s.secrets {
+		if secret.Scoped() {
+			return s.secrets, nil
+		}
+	}
 	return s.parts, nil
 }
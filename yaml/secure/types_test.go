@@ -29,5 +29,82 @@ func Test_MapEqualSlice(t *testing.T) {
 			g.Assert(out.Environment.Map()["FOO"]).Equal("BAR")
 			g.Assert(out.Environment.Map()["BAZ"]).Equal("BOO")
 		})
+
+		g.It("Should unmarshal scoped secrets", func() {
+			out := &Secure{}
+			err := yaml.Unmarshal([]byte(scopedYaml), out)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(out.Environment.Map()["FOO"]).Equal("BAR")
+			g.Assert(out.Environment.Map()["TOKEN"]).Equal("BAZ")
+
+			secret := out.Environment.Secrets()["TOKEN"]
+			g.Assert(secret.Scoped()).IsTrue()
+			g.Assert(secret.Images).Equal([]string{"heroku"})
+			g.Assert(secret.Events).Equal([]string{"push", "tag"})
+			g.Assert(secret.Branches).Equal([]string{"master", "release/*"})
+			g.Assert(out.Environment.Secrets()["FOO"].Scoped()).IsFalse()
+		})
+
+		g.It("Should marshal scoped secrets", func() {
+			out := &Secure{}
+			yaml.Unmarshal([]byte(scopedYaml), out)
+			raw, err := yaml.Marshal(out.Environment)
+			g.Assert(err == nil).IsTrue()
+
+			in := MapEqualSlice{}
+			err = yaml.Unmarshal(raw, &in)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(in.Secrets()).Equal(out.Environment.Secrets())
+		})
+	})
+
+	g.Describe("Secret", func() {
+
+		g.It("Should match any build without restrictions", func() {
+			secret := &Secret{Value: "BAR"}
+			g.Assert(secret.MatchBuild("pull_request", "feature")).IsTrue()
+			g.Assert(secret.MatchImage("golang:1.5")).IsTrue()
+		})
+
+		g.It("Should match build events and branches", func() {
+			secret := &Secret{
+				Events:   []string{"push", "tag"},
+				Branches: []string{"master", "release/*"},
+			}
+			g.Assert(secret.MatchBuild("push", "master")).IsTrue()
+			g.Assert(secret.MatchBuild("tag", "release/1.0")).IsTrue()
+			g.Assert(secret.MatchBuild("pull_request", "master")).IsFalse()
+			g.Assert(secret.MatchBuild("push", "feature")).IsFalse()
+		})
+
+		g.It("Should match images with and without tags", func() {
+			secret := &Secret{Images: []string{"docker.io/library/*"}}
+			g.Assert(secret.MatchImage("docker.io/library/golang:1.5")).IsTrue()
+			g.Assert(secret.MatchImage("quay.io/library/golang:1.5")).IsFalse()
+
+			secret = &Secret{Images: []string{"library/golang"}}
+			g.Assert(secret.MatchImage("library/golang")).IsTrue()
+			g.Assert(secret.MatchImage("library/golang:1.5")).IsTrue()
+			g.Assert(secret.MatchImage("library/node")).IsFalse()
+		})
+
+		g.It("Should match plugin aliases", func() {
+			secret := &Secret{Images: []string{"heroku", "docker_hub"}}
+			g.Assert(secret.MatchImage("heroku")).IsTrue()
+			g.Assert(secret.MatchImage("plugins/drone-heroku:latest")).IsTrue()
+			g.Assert(secret.MatchImage("docker-hub")).IsTrue()
+			g.Assert(secret.MatchImage("plugins/drone-s3")).IsFalse()
+		})
 	})
 }
+
+var scopedYaml = `
+checksum: fa4d4048a6bd1a94f2775039ecf29b812d9cfe6b
+environment:
+  FOO: BAR
+  TOKEN:
+    value: BAZ
+    images: [ heroku ]
+    events: [ push, tag ]
+    branches: [ master, release/* ]
+`
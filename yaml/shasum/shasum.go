@@ -34,6 +34,27 @@ func Check(in, checksum string) bool {
 	return false
 }
 
+// Sum calculates the checksum of a file using the sha1, sha256
+// or sha512 algorithm. If a file name is provided the checksum
+// includes the file size and name, which are verified by Check.
+func Sum(in, name, algorithm string) (string, error) {
+	var hash string
+	switch algorithm {
+	case "sha1":
+		hash = sha1sum(in)
+	case "sha256", "":
+		hash = sha256sum(in)
+	case "sha512":
+		hash = sha512sum(in)
+	default:
+		return "", fmt.Errorf("shasum: unsupported algorithm %s", algorithm)
+	}
+	if len(name) == 0 {
+		return hash, nil
+	}
+	return fmt.Sprintf("%s %d %s", hash, len(in), name), nil
+}
+
 func sha1sum(in string) string {
 	h := sha1.New()
 	io.WriteString(h, in)
@@ -49,6 +49,20 @@ func TestParse(t *testing.T) {
 			g.Assert(hash).Equal("f1d2d2f924e986ac86fdf7b36c94bcdf32beec15")
 		})
 
+		g.It("Should calc a checksum with file size and name", func() {
+			sum, err := Sum("foo\n", ".drone.yml", "sha256")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(sum).Equal("b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c 4 .drone.yml")
+			g.Assert(Check("foo\n", sum)).IsTrue()
+			g.Assert(Check("bar\n", sum)).IsFalse()
+
+			sum, _ = Sum("foo\n", "", "sha1")
+			g.Assert(sum).Equal("f1d2d2f924e986ac86fdf7b36c94bcdf32beec15")
+
+			_, err = Sum("foo\n", "", "md5")
+			g.Assert(err != nil).IsTrue()
+		})
+
 		g.It("Should validate sha1 sum with file size", func() {
 			ok := Check("foo\n", "f1d2d2f924e986ac86fdf7b36c94bcdf32beec15 4 -")
 			g.Assert(ok).IsTrue()
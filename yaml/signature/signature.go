@@ -0,0 +1,130 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnsigned is returned when the Yaml file has no signature.
+	ErrUnsigned = errors.New("signature: configuration is not signed")
+
+	// ErrInvalid is returned when the signature is not valid for
+	// any of the trusted keys.
+	ErrInvalid = errors.New("signature: configuration signature is not valid for the trusted keys")
+)
+
+// pssOptions are the RSA-PSS options used to sign and verify,
+// with a salt length equal to the hash length.
+var pssOptions = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+
+// Verify verifies the base64 encoded detached signature of the
+// Yaml file with the PEM encoded trusted public keys. Ed25519
+// and RSA-PSS with SHA-256 signatures are supported. Keys that
+// cannot be decoded are skipped, and the decoding error is only
+// returned if none of the keys could be decoded.
+func Verify(in, signature string, keys []string) error {
+	if len(signature) == 0 {
+		return ErrUnsigned
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("signature: invalid encoding: %s", err)
+	}
+	var decoded int
+	for _, key := range keys {
+		pub, derr := decodePublicKey(key)
+		if derr != nil {
+			err = derr
+			continue
+		}
+		decoded++
+		if verify(pub, []byte(in), sig) {
+			return nil
+		}
+	}
+	if decoded == 0 && err != nil {
+		return err
+	}
+	return ErrInvalid
+}
+
+// Sign signs the Yaml file with the PEM encoded Ed25519 or RSA
+// private key, and returns the base64 encoded signature.
+func Sign(in, privKey string) (string, error) {
+	block, _ := pem.Decode([]byte(privKey))
+	if block == nil {
+		return "", errors.New("signature: no PEM encoded private key")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return "", fmt.Errorf("signature: unsupported private key type %q", block.Type)
+	}
+	if err != nil {
+		return "", fmt.Errorf("signature: invalid private key: %s", err)
+	}
+
+	var sig []byte
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, []byte(in))
+	case *rsa.PrivateKey:
+		hash := sha256.Sum256([]byte(in))
+		sig, err = rsa.SignPSS(rand.Reader, key, crypto.SHA256, hash[:], pssOptions)
+	default:
+		return "", fmt.Errorf("signature: unsupported private key %T", key)
+	}
+	return base64.StdEncoding.EncodeToString(sig), err
+}
+
+func verify(pub interface{}, in, sig []byte) bool {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, in, sig)
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(in)
+		return rsa.VerifyPSS(pub, crypto.SHA256, hash[:], sig, pssOptions) == nil
+	}
+	return false
+}
+
+// decodePublicKey is a helper function that unmarshals a PEM
+// block to an Ed25519 or RSA Public Key.
+func decodePublicKey(publicKey string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return nil, errors.New("signature: no PEM encoded public key")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("signature: unsupported public key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signature: invalid public key: %s", err)
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *rsa.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("signature: unsupported public key %T", key)
+}
@@ -0,0 +1,91 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestSignature(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Signature", func() {
+
+		edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+		rsaPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+		edPrivPEM := encodePrivateKey(edPriv)
+		edPubPEM := encodePublicKey(edPub)
+		rsaPrivPEM := encodePrivateKey(rsaPriv)
+		rsaPubPEM := encodePublicKey(&rsaPriv.PublicKey)
+
+		g.It("Should verify an ed25519 signature", func() {
+			sig, err := Sign(config, edPrivPEM)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(Verify(config, sig, []string{edPubPEM}) == nil).IsTrue()
+		})
+
+		g.It("Should verify an RSA-PSS signature", func() {
+			sig, err := Sign(config, rsaPrivPEM)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(Verify(config, sig, []string{rsaPubPEM}) == nil).IsTrue()
+		})
+
+		g.It("Should try each trusted key", func() {
+			sig, _ := Sign(config, rsaPrivPEM)
+			g.Assert(Verify(config, sig, []string{edPubPEM, rsaPubPEM}) == nil).IsTrue()
+		})
+
+		g.It("Should skip malformed trusted keys", func() {
+			sig, _ := Sign(config, edPrivPEM)
+			g.Assert(Verify(config, sig, []string{"bad", edPubPEM}) == nil).IsTrue()
+			g.Assert(Verify(config, sig, []string{"bad", rsaPubPEM})).Equal(ErrInvalid)
+		})
+
+		g.It("Should reject a modified configuration", func() {
+			sig, _ := Sign(config, edPrivPEM)
+			err := Verify(config+"\n  - echo $$SECRET", sig, []string{edPubPEM})
+			g.Assert(err).Equal(ErrInvalid)
+		})
+
+		g.It("Should reject an untrusted key", func() {
+			sig, _ := Sign(config, edPrivPEM)
+			err := Verify(config, sig, []string{rsaPubPEM})
+			g.Assert(err).Equal(ErrInvalid)
+		})
+
+		g.It("Should reject an unsigned configuration", func() {
+			err := Verify(config, "", []string{edPubPEM})
+			g.Assert(err).Equal(ErrUnsigned)
+		})
+
+		g.It("Should return an error for malformed input", func() {
+			g.Assert(Verify(config, "!", []string{edPubPEM}) != nil).IsTrue()
+			g.Assert(Verify(config, "YWJj", []string{"not a key"}) != nil).IsTrue()
+			_, err := Sign(config, "not a key")
+			g.Assert(err != nil).IsTrue()
+		})
+	})
+}
+
+func encodePrivateKey(key interface{}) string {
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func encodePublicKey(key interface{}) string {
+	der, _ := x509.MarshalPKIXPublicKey(key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+var config = `
+build:
+  image: golang
+  commands:
+    - go build
+`
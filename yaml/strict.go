@@ -0,0 +1,144 @@
+package yaml
+
+import (
+	"fmt"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// KeyError reports an unknown key found when parsing a Yaml
+// configuration file in strict mode.
+type KeyError struct {
+	Line    int
+	Column  int
+	Section string // section containing the key
+	Key     string
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("yaml: line %d: unknown %s key %q", e.Line, e.Section, e.Key)
+}
+
+// ParseStrict parses a Yaml configuration file, returning a
+// *KeyError if the file contains an unknown section, or an
+// unknown key in a container, build or when section. Plugin
+// steps may contain any key, since unknown keys are passed
+// to the plugin as arguments. Files using an older version of
+// the format are checked once upgraded to the current version.
+func ParseStrict(in []byte) (*Config, error) {
+	in, err := Migrate(in)
+	if err != nil {
+		return nil, err
+	}
+	doc := yamlv3.Node{}
+	err = yamlv3.Unmarshal(in, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) != 0 {
+		err = checkSections(doc.Content[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Parse(in)
+}
+
+// ParseStringStrict parses a Yaml configuration file in
+// string format, rejecting unknown keys.
+func ParseStringStrict(in string) (*Config, error) {
+	return ParseStrict([]byte(in))
+}
+
+// checkSections returns an error for the first unknown key
+// in the configuration file.
+func checkSections(n *yamlv3.Node) (err error) {
+	if resolve(n).Kind != yamlv3.MappingNode {
+		return nil // type errors are reported by the decoder
+	}
+	eachKey(n, func(key, val *yamlv3.Node) {
+		if err != nil {
+			return
+		}
+		switch key.Value {
+		case "build":
+			err = checkKeys(val, "build", containerKeys, buildKeys)
+		case "compose":
+			eachKey(val, func(_, ctr *yamlv3.Node) {
+				if err == nil {
+					err = checkKeys(ctr, "compose", containerKeys)
+				}
+			})
+		case "cache", "clone":
+			err = checkFilterKeys(val)
+		case "publish", "deploy", "notify":
+			eachKey(val, func(_, plugin *yamlv3.Node) {
+				if err == nil {
+					err = checkFilterKeys(plugin)
+				}
+			})
+		default:
+			if _, ok := configKeys[key.Value]; !ok {
+				err = newKeyError(key, "top-level")
+			}
+		}
+	})
+	return err
+}
+
+// checkKeys returns an error for the first key in the
+// mapping that is not a known key.
+func checkKeys(n *yamlv3.Node, section string, keys ...map[string]checkFunc) (err error) {
+	if resolve(n).Kind != yamlv3.MappingNode {
+		return nil
+	}
+	eachKey(n, func(key, val *yamlv3.Node) {
+		if err != nil {
+			return
+		}
+		for _, known := range keys {
+			if _, ok := known[key.Value]; ok {
+				err = checkNestedKeys(key, val)
+				return
+			}
+		}
+		err = newKeyError(key, section)
+	})
+	return err
+}
+
+// checkFilterKeys returns an error for the first unknown key
+// in the when and auth_config sections of a plugin. Other
+// keys are plugin arguments.
+func checkFilterKeys(n *yamlv3.Node) (err error) {
+	if resolve(n).Kind != yamlv3.MappingNode {
+		return nil
+	}
+	eachKey(n, func(key, val *yamlv3.Node) {
+		if err == nil {
+			err = checkNestedKeys(key, val)
+		}
+	})
+	return err
+}
+
+// checkNestedKeys returns an error for the first unknown key
+// in a nested when or auth_config section.
+func checkNestedKeys(key, val *yamlv3.Node) error {
+	switch key.Value {
+	case "when":
+		return checkKeys(val, "when", filterKeys)
+	case "auth_config":
+		return checkKeys(val, "auth_config", authConfigKeys)
+	}
+	return nil
+}
+
+func newKeyError(key *yamlv3.Node, section string) error {
+	return &KeyError{
+		Line:    key.Line,
+		Column:  key.Column,
+		Section: section,
+		Key:     key.Value,
+	}
+}
@@ -0,0 +1,46 @@
+package yaml
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestParseStrict(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Parse Yaml strictly", func() {
+
+		g.It("Should accept known keys and plugin arguments", func() {
+			conf, err := ParseStringStrict(sample)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(conf.Deploy.Slice()[0].Vargs["app"]).Equal("foo.com")
+		})
+
+		g.It("Should reject unknown sections", func() {
+			_, err := ParseStringStrict(variables)
+			g.Assert(err.Error()).Equal(`yaml: line 2: unknown top-level key "build_values"`)
+		})
+
+		g.It("Should reject unknown build keys", func() {
+			_, err := ParseStringStrict(lintTypos)
+			g.Assert(err.Error()).Equal(`yaml: line 4: unknown build key "comands"`)
+		})
+
+		g.It("Should reject unknown compose keys", func() {
+			_, err := ParseStringStrict("compose:\n  redis:\n    imag: redis\n")
+			g.Assert(err.(*KeyError).Key).Equal("imag")
+			g.Assert(err.(*KeyError).Section).Equal("compose")
+		})
+
+		g.It("Should reject unknown filter keys", func() {
+			_, err := ParseStringStrict(lintFilter)
+			g.Assert(err.Error()).Equal(`yaml: line 6: unknown when key "brnch"`)
+		})
+
+		g.It("Should reject unknown build filter keys", func() {
+			_, err := ParseStringStrict("build:\n  image: golang\n  when:\n    evnt: push\n")
+			g.Assert(err.Error()).Equal(`yaml: line 4: unknown when key "evnt"`)
+		})
+	})
+}
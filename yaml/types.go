@@ -3,29 +3,32 @@ package yaml
 // Config is a typed representation of the
 // Yaml configuration file.
 type Config struct {
-	Cache Plugin
-	Clone Plugin
-	Build Build
+	Cache Plugin `yaml:",omitempty"`
+	Clone Plugin `yaml:",omitempty"`
+	Build Build  `yaml:",omitempty"`
 
-	Compose Containerslice
-	Publish Pluginslice
-	Deploy  Pluginslice
-	Notify  Pluginslice
+	Compose Containerslice `yaml:",omitempty"`
+	Publish Pluginslice    `yaml:",omitempty"`
+	Deploy  Pluginslice    `yaml:",omitempty"`
+	Notify  Pluginslice    `yaml:",omitempty"`
 }
 
 // Container is a typed representation of a
 // docker step in the Yaml configuration file.
 type Container struct {
-	Image       string
-	Pull        bool
-	Privileged  bool
-	Environment MapEqualSlice
-	Entrypoint  Command
-	Command     Command
-	ExtraHosts  []string `yaml:"extra_hosts"`
-	Volumes     []string
-	Net         string
-	AuthConfig  AuthConfig `yaml:"auth_config"`
+	Name        string        `yaml:"-"`
+	Image       string        `yaml:",omitempty"`
+	Pull        bool          `yaml:",omitempty"`
+	Privileged  bool          `yaml:",omitempty"`
+	Environment MapEqualSlice `yaml:",omitempty"`
+	Entrypoint  Command       `yaml:",omitempty"`
+	Command     Command       `yaml:",omitempty"`
+	ExtraHosts  []string      `yaml:"extra_hosts,omitempty"`
+	Volumes     []string      `yaml:",omitempty"`
+	Net         string        `yaml:",omitempty"`
+	AuthConfig  AuthConfig    `yaml:"auth_config,omitempty"`
+	Secrets     []SecretFile  `yaml:",omitempty"`
+	Filter      Filter        `yaml:"when,omitempty"`
 }
 
 // Build is a typed representation of the build
@@ -33,15 +36,24 @@ type Container struct {
 type Build struct {
 	Container `yaml:",inline"`
 
-	Commands []string
+	Commands []string `yaml:",omitempty"`
+	Shell    Command  `yaml:",omitempty"`
 }
 
 // Auth for Docker Image Registry
 type AuthConfig struct {
-	Username      string `yaml:"username"`
-	Password      string `yaml:"password"`
-	Email         string `yaml:"email"`
-	RegistryToken string `yaml:"registry_token"`
+	Username      string `yaml:"username,omitempty"`
+	Password      string `yaml:"password,omitempty"`
+	Email         string `yaml:"email,omitempty"`
+	RegistryToken string `yaml:"registry_token,omitempty"`
+}
+
+// SecretFile is a typed representation of a secret
+// mounted as a file into a docker step, instead of
+// being injected into the Yaml file.
+type SecretFile struct {
+	Source string `yaml:"source"`
+	Target string `yaml:"target,omitempty"`
 }
 
 // Plugin is a typed representation of a
@@ -50,8 +62,7 @@ type AuthConfig struct {
 type Plugin struct {
 	Container `yaml:",inline"`
 
-	Vargs  Vargs  `yaml:",inline"`
-	Filter Filter `yaml:"when"`
+	Vargs Vargs `yaml:",inline"`
 }
 
 // Vargs holds unstructured arguments, specific
@@ -63,11 +74,13 @@ type Vargs map[string]interface{}
 // used at runtime to decide if a particular
 // plugin should be executed or skipped.
 type Filter struct {
-	Repo    string
-	Branch  Stringorslice
-	Event   Stringorslice
-	Success string
-	Failure string
-	Change  string
-	Matrix  map[string]string
+	Repo    string            `yaml:",omitempty"`
+	Branch  Stringorslice     `yaml:",omitempty"`
+	Tag     Stringorslice     `yaml:",omitempty"`
+	Event   Stringorslice     `yaml:",omitempty"`
+	Success string            `yaml:",omitempty"`
+	Failure string            `yaml:",omitempty"`
+	Change  string            `yaml:",omitempty"`
+	Matrix  map[string]string `yaml:",omitempty"`
+	Expr    string            `yaml:",omitempty"`
 }
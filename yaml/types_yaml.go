@@ -2,6 +2,7 @@ package yaml
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/flynn/go-shlex"
@@ -30,6 +31,18 @@ func (s *Command) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return err
 }
 
+// MarshalYAML implements the Marshaller interface. The
+// command is always written as a list, since splitting a
+// string is lossy.
+func (s Command) MarshalYAML() (interface{}, error) {
+	return s.parts, nil
+}
+
+// IsZero returns true if the command is empty.
+func (s Command) IsZero() bool {
+	return len(s.parts) == 0
+}
+
 func (s *Command) Slice() []string {
 	return s.parts
 }
@@ -55,9 +68,22 @@ func (s *MapEqualSlice) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		s.parts = append(s.parts, strings.Join([]string{k, v}, "="))
 	}
 
+	// sorts the variables since map ordering is random.
+	sort.Strings(s.parts)
 	return nil
 }
 
+// MarshalYAML implements the Marshaller interface. The
+// variables are written as a list of KEY=VALUE strings.
+func (s MapEqualSlice) MarshalYAML() (interface{}, error) {
+	return s.parts, nil
+}
+
+// IsZero returns true if there are no variables.
+func (s MapEqualSlice) IsZero() bool {
+	return len(s.parts) == 0
+}
+
 func (s *MapEqualSlice) Slice() []string {
 	return s.parts
 }
@@ -73,6 +99,11 @@ func (s Stringorslice) MarshalYAML() (interface{}, error) {
 	return s.parts, nil
 }
 
+// IsZero returns true if the Stringorslice is empty.
+func (s Stringorslice) IsZero() bool {
+	return len(s.parts) == 0
+}
+
 // UnmarshalYAML implements the Unmarshaller interface.
 func (s *Stringorslice) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var sliceType []string
@@ -135,12 +166,29 @@ func (s *Pluginslice) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		if len(plugin.Image) == 0 {
 			plugin.Image = key
 		}
+		plugin.Name = key
 		s.parts = append(s.parts, plugin)
 		return nil
 	})
 	return err
 }
 
+// MarshalYAML implements the Marshaller interface. The
+// plugins are written as a map keyed by step name, in
+// order.
+func (s Pluginslice) MarshalYAML() (interface{}, error) {
+	obj := yaml.MapSlice{}
+	for _, plugin := range s.parts {
+		obj = append(obj, yaml.MapItem{Key: plugin.Name, Value: plugin})
+	}
+	return obj, nil
+}
+
+// IsZero returns true if there are no plugins.
+func (s Pluginslice) IsZero() bool {
+	return len(s.parts) == 0
+}
+
 func (s *Pluginslice) Slice() []Plugin {
 	return s.parts
 }
@@ -172,11 +220,28 @@ func (s *Containerslice) UnmarshalYAML(unmarshal func(interface{}) error) error
 		if len(ctr.Image) == 0 {
 			ctr.Image = key
 		}
+		ctr.Name = key
 		s.parts = append(s.parts, ctr)
 		return nil
 	})
 }
 
+// MarshalYAML implements the Marshaller interface. The
+// containers are written as a map keyed by step name, in
+// order.
+func (s Containerslice) MarshalYAML() (interface{}, error) {
+	obj := yaml.MapSlice{}
+	for _, ctr := range s.parts {
+		obj = append(obj, yaml.MapItem{Key: ctr.Name, Value: ctr})
+	}
+	return obj, nil
+}
+
+// IsZero returns true if there are no containers.
+func (s Containerslice) IsZero() bool {
+	return len(s.parts) == 0
+}
+
 func (s *Containerslice) Slice() []Container {
 	return s.parts
 }
@@ -207,3 +272,53 @@ func unmarshalYaml(v yaml.MapSlice, emit unmarshal) error {
 	}
 	return nil
 }
+
+// Buildslice is a slice of Builds with a custom Yaml
+// unarmshal function to preserve ordering.
+type Buildslice struct {
+	parts []Build
+}
+
+func (s *Buildslice) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	// unmarshal the yaml into the generic
+	// mapSlice type to preserve ordering.
+	obj := yaml.MapSlice{}
+	err := unmarshal(&obj)
+	if err != nil {
+		return err
+	}
+
+	// unarmshals each item in the mapSlice,
+	// unmarshal and append to the slice.
+	return unmarshalYaml(obj, func(key string, val []byte) error {
+		build := Build{}
+		err := yaml.Unmarshal(val, &build)
+		if err != nil {
+			return err
+		}
+		build.Name = key
+		s.parts = append(s.parts, build)
+		return nil
+	})
+}
+
+// MarshalYAML implements the Marshaller interface. The
+// builds are written as a map keyed by step name, in
+// order.
+func (s Buildslice) MarshalYAML() (interface{}, error) {
+	obj := yaml.MapSlice{}
+	for _, build := range s.parts {
+		obj = append(obj, yaml.MapItem{Key: build.Name, Value: build})
+	}
+	return obj, nil
+}
+
+// IsZero returns true if there are no builds.
+func (s Buildslice) IsZero() bool {
+	return len(s.parts) == 0
+}
+
+func (s *Buildslice) Slice() []Build {
+	return s.parts
+}
@@ -0,0 +1,110 @@
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Version is the current version of the Yaml configuration
+// format. Configuration files declare the version using the
+// top-level version key, and files without a version key are
+// assumed to use version 1.
+const Version = 1
+
+// migrations upgrade a document by a single version. The
+// migration at index i upgrades version i+1 to version i+2.
+// Version 1 is the first version of the format, so there is
+// nothing to upgrade yet.
+var migrations = []func(n *yamlv3.Node) error{}
+
+// ParseVersion returns the version of the Yaml configuration
+// file, or an error if the version is not supported.
+func ParseVersion(in []byte) (int, error) {
+	var head struct {
+		Version int
+	}
+	err := yaml.Unmarshal(in, &head)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case head.Version == 0:
+		return 1, nil
+	case head.Version < 0 || head.Version > Version:
+		return 0, fmt.Errorf("yaml: unsupported version %d, expected a version between 1 and %d", head.Version, Version)
+	}
+	return head.Version, nil
+}
+
+// Migrate upgrades a Yaml configuration file to the current
+// version of the format. Comments are preserved where
+// possible. The configuration is returned unchanged if it
+// already uses the current version.
+func Migrate(in []byte) ([]byte, error) {
+	version, err := ParseVersion(in)
+	if err != nil {
+		return nil, err
+	}
+	if version == Version {
+		return in, nil
+	}
+
+	doc := yamlv3.Node{}
+	err = yamlv3.Unmarshal(in, &doc)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+	if root.Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("yaml: configuration must be a map")
+	}
+	for _, migrate := range migrations[version-1:] {
+		err = migrate(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+	setVersion(root, Version)
+
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err = enc.Encode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Close()
+	return buf.Bytes(), err
+}
+
+// MigrateString upgrades a Yaml configuration file in
+// string format to the current version of the format.
+func MigrateString(in string) (string, error) {
+	out, err := Migrate([]byte(in))
+	return string(out), err
+}
+
+// setVersion sets the version key, adding it at the top of
+// the document if missing.
+func setVersion(n *yamlv3.Node, version int) {
+	val := fmt.Sprint(version)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == "version" {
+			n.Content[i+1].Value = val
+			n.Content[i+1].Tag = "!!int"
+			return
+		}
+	}
+	n.Content = append([]*yamlv3.Node{scalarNode("version"), intNode(val)}, n.Content...)
+}
+
+func scalarNode(val string) *yamlv3.Node {
+	return &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: val}
+}
+
+func intNode(val string) *yamlv3.Node {
+	return &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!int", Value: val}
+}
@@ -0,0 +1,43 @@
+package yaml
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+func TestVersion(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	g.Describe("Yaml versions", func() {
+
+		g.It("Should detect the version", func() {
+			v, err := ParseVersion([]byte(sample))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(v).Equal(Version)
+
+			v, _ = ParseVersion([]byte("version: 1\n"))
+			g.Assert(v).Equal(1)
+		})
+
+		g.It("Should reject unsupported versions", func() {
+			_, err := ParseVersion([]byte("version: 99\n"))
+			g.Assert(err.Error()).Equal("yaml: unsupported version 99, expected a version between 1 and 1")
+		})
+
+		g.It("Should return current documents unchanged", func() {
+			out, err := MigrateString(sample)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(out).Equal(sample)
+
+			out, err = MigrateString("version: 1\n" + sample)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(out).Equal("version: 1\n" + sample)
+		})
+
+		g.It("Should not accept top-level build keys", func() {
+			_, err := ParseStringStrict("image: golang\nscript:\n  - go build\n")
+			g.Assert(err != nil).IsTrue()
+		})
+	})
+}